@@ -18,20 +18,18 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/apache/cloudstack-cloudmonkey/cmd"
 	"github.com/apache/cloudstack-cloudmonkey/config"
 )
 
-var nameSupportingApis = []string{
-	"configuration",
-}
-
 func buildAPICacheMap(apiMap map[string][]*config.API) map[string][]*config.API {
 	for _, cmd := range cmd.AllCommands() {
 		verb := cmd.Name
@@ -108,10 +106,7 @@ func lastString(array []string) string {
 	return array[len(array)-1]
 }
 
-type argOption struct {
-	Value  string
-	Detail string
-}
+type argOption = config.CompletionOption
 
 func buildArgOptions(response map[string]interface{}, hasID bool) []argOption {
 	argOptions := []argOption{}
@@ -197,107 +192,111 @@ func doInternal(line []rune, pos int, lineLen int, argName []rune) (newLine [][]
 	return
 }
 
-func findAPI(apiMap map[string][]*config.API, relatedNoun string) *config.API {
-	var autocompleteAPI *config.API
-	for _, listAPI := range apiMap["list"] {
-		if relatedNoun == listAPI.Noun {
-			autocompleteAPI = listAPI
-			break
+// completeMapKeys completes the keys of a map arg value written as
+// {key:value,...} or [{key:value,...},...]
+func completeMapKeys(keys []string, argInput string) (options [][]rune, offset int) {
+	if len(keys) == 0 {
+		return nil, 0
+	}
+	if len(argInput) == 0 {
+		return [][]rune{[]rune("{")}, 0
+	}
+	input := argInput[strings.LastIndexAny(argInput, "{[,")+1:]
+	if strings.ContainsAny(input, ":=}]") {
+		return nil, 0
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, input) {
+			options = append(options, []rune(key[len(input):]+":"))
 		}
 	}
-	return autocompleteAPI
+	return options, len(input)
 }
 
-func findAutocompleteAPI(arg *config.APIArg, apiFound *config.API, apiMap map[string][]*config.API) *config.API {
-	if arg.Type == "map" {
-		return nil
-	}
+type autoCompleter struct {
+	Config *config.Config
 
-	var autocompleteAPI *config.API
-	argName := strings.Replace(arg.Name, "=", "", -1)
-	relatedNoun := argName
-	switch {
-	case argName == "id" || argName == "ids":
-		// Heuristic: user is trying to autocomplete for id/ids arg for a list API
-		relatedNoun = apiFound.Noun
-		if apiFound.Verb != "list" {
-			relatedNoun += "s"
-		}
-	case argName == "account":
-		// Heuristic: user is trying to autocomplete for accounts
-		relatedNoun = "accounts"
-	case argName == "ipaddressid":
-		// Heuristic: user is trying to autocomplete for ip addresses
-		relatedNoun = "publicipaddresses"
-	case argName == "storageid":
-		relatedNoun = "storagepools"
-	case argName == "associatednetworkid":
-		relatedNoun = "networks"
-	default:
-		// Heuristic: autocomplete for the arg for which a list<Arg without id/ids>s API exists
-		// For example, for zoneid arg, listZones API exists
-		base := argName
-		if strings.HasSuffix(argName, "id") {
-			base = strings.TrimSuffix(argName, "id")
-		} else if strings.HasSuffix(argName, "ids") {
-			base = strings.TrimSuffix(argName, "ids")
-		} else if argName == "name" {
-			for _, noun := range nameSupportingApis {
-				if strings.HasPrefix(apiFound.Noun, noun) {
-					base = noun
-					break
-				}
-			}
-		}
-		// Handle common cases where base ends with a vowel and needs "es"
-		if strings.HasSuffix(base, "s") || strings.HasSuffix(base, "x") || strings.HasSuffix(base, "z") || strings.HasSuffix(base, "ch") || strings.HasSuffix(base, "sh") {
-			relatedNoun = base + "es"
-		} else {
-			relatedNoun = base + "s"
-		}
-	}
+	// setLine replaces the line being edited, for fuzzy matched candidates
+	// which replace the typed input
+	setLine func(line string)
+	// last is the completion of the line set by the last fuzzy completion
+	last *fuzzyCompletion
+}
 
-	config.Debug("Possible related noun for the arg: ", relatedNoun, " and type: ", arg.Type)
-	autocompleteAPI = findAPI(apiMap, relatedNoun)
+// fuzzy returns true if completion matches options fuzzily rather than by prefix
+func (t *autoCompleter) fuzzy() bool {
+	return t.Config.Core.Completion == "fuzzy"
+}
 
-	if autocompleteAPI == nil {
-		if strings.Contains(strings.ToLower(relatedNoun), "storage") {
-			relatedNoun = "storagepools"
-			autocompleteAPI = findAPI(apiMap, relatedNoun)
-		}
+// listArgOptions calls a list API using the provided context and returns the
+// arg options it lists
+func (t *autoCompleter) listArgOptions(ctx context.Context, apiName string, args []string, hasID bool) ([]argOption, error) {
+	request := cmd.NewRequest(nil, t.Config, nil, false)
+	response, err := cmd.NewAPIRequestWithContext(ctx, request, apiName, args, false)
+	if err != nil {
+		return nil, err
 	}
+	return buildArgOptions(response, hasID), nil
+}
 
-	if autocompleteAPI != nil {
-		config.Debug("Autocomplete: API found using heuristics: ", autocompleteAPI.Name)
-	}
+// waitArgOptions lists arg options while showing a spinner, the request can be
+// interrupted
+func (t *autoCompleter) waitArgOptions(apiName string, args []string, hasID bool) ([]argOption, error) {
+	waiter := t.Config.StartSpinner("fetching options, please wait...")
+	defer t.Config.StopSpinner(waiter)
+	config.SetupContext(t.Config)
+	return t.listArgOptions(*t.Config.Context, apiName, args, hasID)
+}
 
-	if strings.HasSuffix(relatedNoun, "s") {
-		relatedNoun = relatedNoun[:len(relatedNoun)-1]
+// fetchArgOptions returns the arg options listed by an API, they are served
+// from the completion cache and stale options are refreshed in the background
+func (t *autoCompleter) fetchArgOptions(api *config.API, args []string, hasID bool) []argOption {
+	ttl := time.Duration(t.Config.Core.CompletionTTL) * time.Second
+	if ttl <= 0 {
+		options, _ := t.waitArgOptions(api.Name, args, hasID)
+		return options
 	}
-
-	// Heuristic: find any list API that contains the arg name
-	if autocompleteAPI == nil {
-		config.Debug("Finding possible API that have: ", argName, " related APIs: ", arg.Related)
-		possibleAPIs := []*config.API{}
-		for _, listAPI := range apiMap["list"] {
-			if strings.Contains(listAPI.Noun, argName) {
-				config.Debug("Found possible API: ", listAPI.Name)
-				possibleAPIs = append(possibleAPIs, listAPI)
-			}
-		}
-		if len(possibleAPIs) == 1 {
-			autocompleteAPI = possibleAPIs[0]
+	apiName, noun := api.Name, api.Noun
+	cache := t.Config.CompletionCache()
+	key := fmt.Sprintf("%s %s hasid=%v", apiName, strings.Join(args, " "), hasID)
+	options, fresh, found := cache.Get(key, ttl)
+	if found {
+		if !fresh && cache.StartRefresh(key) {
+			go func() {
+				options, err := t.listArgOptions(context.Background(), apiName, args, hasID)
+				if err != nil {
+					cache.FinishRefresh(key)
+					return
+				}
+				cache.Put(key, noun, options)
+			}()
 		}
+		return options
 	}
-
-	return autocompleteAPI
+	options, err := t.waitArgOptions(apiName, args, hasID)
+	if err == nil {
+		cache.Put(key, noun, options)
+	}
+	return options
 }
 
-type autoCompleter struct {
-	Config *config.Config
+// Do returns the completion options for a line, options of fuzzy matches are
+// written in place of the typed input
+func (t *autoCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	if t.last != nil && pos == len(line) && string(line) == t.last.line {
+		return t.last.options, t.last.offset
+	}
+	t.last = nil
+	options, offset, match := t.complete(line, pos)
+	if match != nil {
+		return t.replaceInput(line, pos, match)
+	}
+	return options, offset
 }
 
-func (t *autoCompleter) Do(line []rune, pos int) (options [][]rune, offset int) {
+// complete returns the completion options for a line, or the fuzzy match of
+// the typed input
+func (t *autoCompleter) complete(line []rune, pos int) (options [][]rune, offset int, match *fuzzyMatch) {
 	apiMap := buildAPICacheMap(t.Config.GetAPIVerbMap())
 
 	var verbs []string
@@ -325,6 +324,9 @@ func (t *autoCompleter) Do(line []rune, pos int) (options [][]rune, offset int)
 		}
 	}
 	if len(verbFound) == 0 {
+		if t.fuzzy() && !strings.Contains(string(line), " ") {
+			match = fuzzyOptions(string(line), verbs, " ")
+		}
 		return
 	}
 
@@ -343,6 +345,13 @@ func (t *autoCompleter) Do(line []rune, pos int) (options [][]rune, offset int)
 		}
 	}
 	if len(nounFound) == 0 {
+		if t.fuzzy() && !strings.Contains(string(line), " ") {
+			var nouns []string
+			for _, api := range apiMap[verbFound] {
+				nouns = append(nouns, api.Noun)
+			}
+			match = fuzzyOptions(string(line), nouns, " ")
+		}
 		return
 	}
 
@@ -413,9 +422,14 @@ func (t *autoCompleter) Do(line []rune, pos int) (options [][]rune, offset int)
 				return
 			}
 
-			autocompleteAPI := findAutocompleteAPI(arg, apiFound, apiMap)
+			if arg.Type == "map" {
+				options, offset = completeMapKeys(config.MapArgKeys(apiFound, arg), argInput)
+				return
+			}
+
+			autocompleteAPI := config.FindRelatedListAPI(arg, apiFound, apiMap)
 			if autocompleteAPI == nil {
-				return nil, 0
+				return nil, 0, nil
 			}
 
 			completeArgs := t.Config.Core.AutoComplete
@@ -442,13 +456,13 @@ func (t *autoCompleter) Do(line []rune, pos int) (options [][]rune, offset int)
 					}
 				}
 
-				spinner := t.Config.StartSpinner("fetching options, please wait...")
-				request := cmd.NewRequest(nil, completer.Config, nil, false)
-				response, _ := cmd.NewAPIRequest(request, autocompleteAPI.Name, autocompleteAPIArgs, false)
-				t.Config.StopSpinner(spinner)
-
 				hasID := strings.HasSuffix(arg.Name, "id=") || strings.HasSuffix(arg.Name, "ids=") || autocompleteAPI.Name == "listUsageTypes"
-				argOptions = buildArgOptions(response, hasID)
+				argOptions = t.fetchArgOptions(autocompleteAPI, autocompleteAPIArgs, hasID)
+			}
+
+			if t.fuzzy() {
+				match = fuzzyArgOptions(argInput, argOptions)
+				return
 			}
 
 			filteredOptions := []argOption{}
@@ -490,5 +504,14 @@ func (t *autoCompleter) Do(line []rune, pos int) (options [][]rune, offset int)
 		}
 	}
 
-	return options, offset
+	input := string(line)
+	input = input[strings.LastIndex(input, " ")+1:]
+	if t.fuzzy() && !strings.Contains(input, "=") {
+		var argNames []string
+		for _, arg := range apiFound.Args {
+			argNames = append(argNames, arg.Name)
+		}
+		match = fuzzyOptions(input, argNames, "")
+	}
+	return
 }
@@ -58,8 +58,11 @@ func ExecCmd(args []string, credentialsSupplied bool) error {
 		return nil
 	}
 
+	// every command gets a new context, cancelled when it is interrupted
+	config.SetupContext(cfg)
+
 	command := cmd.FindCommand(args[0])
-	if command != nil && !(args[0] == "sync" && len(args) > 1) {
+	if command != nil && !(args[0] == "sync" && len(args) > 1 && args[1] != "--check") {
 		r := cmd.NewRequest(command, cfg, args[1:], credentialsSupplied)
 		return command.Handle(r)
 	}
@@ -0,0 +1,214 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Fuzzy match ranks, a higher rank is a better match
+const (
+	noMatch = iota
+	subsequenceMatch
+	substringMatch
+	wordBoundaryMatch
+	prefixMatch
+)
+
+// isWordBoundary returns true if a word starts at index idx of a string, such
+// as after a separator or at an upper case letter following a lower case one
+func isWordBoundary(word []rune, idx int) bool {
+	if idx == 0 {
+		return true
+	}
+	prev, cur := word[idx-1], word[idx]
+	if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
+
+// fuzzyRank returns how well the input matches a word, ignoring case
+func fuzzyRank(word string, input string) int {
+	if len(input) == 0 {
+		return prefixMatch
+	}
+	lowerWord, lowerInput := strings.ToLower(word), strings.ToLower(input)
+	if strings.HasPrefix(lowerWord, lowerInput) {
+		return prefixMatch
+	}
+	if idx := strings.Index(lowerWord, lowerInput); idx >= 0 {
+		runes := []rune(word)
+		for idx >= 0 {
+			if isWordBoundary(runes, len([]rune(lowerWord[:idx]))) {
+				return wordBoundaryMatch
+			}
+			next := strings.Index(lowerWord[idx+1:], lowerInput)
+			if next < 0 {
+				break
+			}
+			idx += next + 1
+		}
+		return substringMatch
+	}
+	remaining := []rune(lowerInput)
+	for _, r := range lowerWord {
+		if r == remaining[0] {
+			remaining = remaining[1:]
+			if len(remaining) == 0 {
+				return subsequenceMatch
+			}
+		}
+	}
+	return noMatch
+}
+
+// fuzzyMatch holds the candidates fuzzy matching the typed input, which
+// replace the input rather than extend it
+type fuzzyMatch struct {
+	input      string
+	candidates []string
+}
+
+// fuzzyCompletion is the completion of a line whose typed input was replaced
+// by the common prefix of its fuzzy matched candidates
+type fuzzyCompletion struct {
+	line    string
+	options [][]rune
+	offset  int
+}
+
+// fuzzyOptions returns the words matching the input, best matches first, as
+// candidates which end with suffix
+func fuzzyOptions(input string, words []string, suffix string) *fuzzyMatch {
+	type rankedWord struct {
+		word string
+		rank int
+	}
+	var matches []rankedWord
+	seen := make(map[string]bool)
+	for _, word := range words {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		if rank := fuzzyRank(word, input); rank != noMatch {
+			matches = append(matches, rankedWord{word, rank})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].rank > matches[j].rank
+	})
+	match := &fuzzyMatch{input: input}
+	for _, item := range matches {
+		match.candidates = append(match.candidates, item.word+suffix)
+	}
+	return match
+}
+
+// fuzzyArgOptions returns the arg options whose value or detail matches the
+// input, best matches first
+func fuzzyArgOptions(input string, argOptions []argOption) *fuzzyMatch {
+	ranks := make(map[argOption]int)
+	var matches []argOption
+	for _, item := range argOptions {
+		rank := fuzzyRank(item.Value, input)
+		if len(item.Detail) > 0 {
+			if detailRank := fuzzyRank(item.Detail, input); detailRank > rank {
+				rank = detailRank
+			}
+		}
+		if rank != noMatch {
+			ranks[item] = rank
+			matches = append(matches, item)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return ranks[matches[i]] > ranks[matches[j]]
+	})
+	match := &fuzzyMatch{input: input}
+	for _, item := range matches {
+		option := item.Value + " "
+		if len(item.Detail) > 0 {
+			option += fmt.Sprintf("(%v)", item.Detail)
+		}
+		match.candidates = append(match.candidates, option)
+	}
+	return match
+}
+
+// commonPrefix returns the longest common prefix of candidates, up to the
+// detail of an arg option
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		runes := []rune(candidate)
+		idx := 0
+		for idx < len(prefix) && idx < len(runes) && prefix[idx] == runes[idx] {
+			idx++
+		}
+		prefix = prefix[:idx]
+	}
+	common := string(prefix)
+	if idx := strings.Index(common, " ("); idx >= 0 {
+		common = common[:idx]
+	}
+	return common
+}
+
+// replaceInput returns the completion options of a fuzzy match. Readline only
+// writes options at the cursor, so unless every candidate extends the typed
+// input, the input is replaced in the line by the common prefix of the
+// candidates, and options are returned relative to that prefix.
+func (t *autoCompleter) replaceInput(line []rune, pos int, match *fuzzyMatch) ([][]rune, int) {
+	input := []rune(match.input)
+	extends := true
+	for _, candidate := range match.candidates {
+		if !strings.HasPrefix(candidate, match.input) {
+			extends = false
+			break
+		}
+	}
+	if extends || t.setLine == nil || pos != len(line) || len(input) > pos {
+		var options [][]rune
+		for _, candidate := range match.candidates {
+			if strings.HasPrefix(candidate, match.input) {
+				options = append(options, []rune(candidate[len(match.input):]))
+			}
+		}
+		return options, len(input)
+	}
+
+	common := commonPrefix(match.candidates)
+	completion := &fuzzyCompletion{
+		line:   string(line[:pos-len(input)]) + common,
+		offset: len([]rune(common)),
+	}
+	for _, candidate := range match.candidates {
+		completion.options = append(completion.options, []rune(candidate[len(common):]))
+	}
+	t.setLine(completion.line)
+	t.last = completion
+	return completion.options, completion.offset
+}
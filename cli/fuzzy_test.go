@@ -0,0 +1,107 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+func TestFuzzyRank(t *testing.T) {
+	tests := []struct {
+		word  string
+		input string
+		rank  int
+	}{
+		{"listVirtualMachines", "", prefixMatch},
+		{"listVirtualMachines", "listvirt", prefixMatch},
+		{"listVirtualMachines", "machines", wordBoundaryMatch},
+		{"zone-name", "name", wordBoundaryMatch},
+		{"listVirtualMachines", "achine", substringMatch},
+		{"listVirtualMachines", "lvm", subsequenceMatch},
+		{"listVirtualMachines", "xyz", noMatch},
+		{"listVirtualMachines", "machinesz", noMatch},
+	}
+	for _, test := range tests {
+		if rank := fuzzyRank(test.word, test.input); rank != test.rank {
+			t.Errorf("fuzzyRank(%q, %q) = %d, expected %d", test.word, test.input, rank, test.rank)
+		}
+	}
+}
+
+func TestFuzzyOptions(t *testing.T) {
+	words := []string{"listVolumes", "virtualmachine", "listVirtualMachines", "listVirtualMachines", "machines", "listZones"}
+	match := fuzzyOptions("mach", words, " ")
+	expected := []string{"machines ", "listVirtualMachines ", "virtualmachine "}
+	if match.input != "mach" || !reflect.DeepEqual(match.candidates, expected) {
+		t.Errorf("expected candidates %q, got %q", expected, match.candidates)
+	}
+
+	options := []argOption{
+		{Value: "6a0a3f1e", Detail: "zone-east"},
+		{Value: "c95b1a73", Detail: "zone-west"},
+		{Value: "east-pod", Detail: ""},
+	}
+	match = fuzzyArgOptions("east", options)
+	expected = []string{"east-pod ", "6a0a3f1e (zone-east)"}
+	if !reflect.DeepEqual(match.candidates, expected) {
+		t.Errorf("expected arg candidates %q, got %q", expected, match.candidates)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		candidates []string
+		prefix     string
+	}{
+		{nil, ""},
+		{[]string{"listZones "}, "listZones "},
+		{[]string{"listVirtualMachines ", "listVolumes "}, "listV"},
+		{[]string{"6a0a3f1e (zone-east)", "6a0a3f1e (zone-west)"}, "6a0a3f1e"},
+		{[]string{"zone", "pod"}, ""},
+	}
+	for _, test := range tests {
+		if prefix := commonPrefix(test.candidates); prefix != test.prefix {
+			t.Errorf("commonPrefix(%q) = %q, expected %q", test.candidates, prefix, test.prefix)
+		}
+	}
+}
+
+func TestReplaceInput(t *testing.T) {
+	var line string
+	completer := &autoCompleter{Config: &config.Config{}, setLine: func(l string) { line = l }}
+
+	typed := []rune("list vm")
+	match := &fuzzyMatch{input: "vm", candidates: []string{"virtualmachines ", "vmsnapshots "}}
+	options, offset := completer.replaceInput(typed, len(typed), match)
+	if line != "list v" || offset != 1 || len(options) != 2 || string(options[0]) != "irtualmachines " {
+		t.Errorf("expected the input to be replaced by the common prefix, got line %q, options %q, offset %d", line, options, offset)
+	}
+	if completer.last == nil || completer.last.line != "list v" {
+		t.Errorf("expected the completion to be remembered, got %v", completer.last)
+	}
+
+	line = ""
+	match = &fuzzyMatch{input: "vm", candidates: []string{"vmsnapshots ", "vmgroups "}}
+	options, offset = completer.replaceInput(typed, len(typed), match)
+	if line != "" || offset != 2 || string(options[0]) != "snapshots " {
+		t.Errorf("expected options extending the input, got line %q, options %q, offset %d", line, options, offset)
+	}
+}
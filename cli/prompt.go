@@ -22,6 +22,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/apache/cloudstack-cloudmonkey/cmd"
 	"github.com/apache/cloudstack-cloudmonkey/config"
 	"github.com/chzyer/readline"
 )
@@ -63,9 +64,11 @@ func ExecPrompt() {
 		panic(err)
 	}
 	defer shell.Close()
+	completer.setLine = shell.Operation.SetBuffer
 
 	cfg.HasShell = true
 	cfg.PrintHeader()
+	cmd.AutoSync(cmd.NewRequest(nil, cfg, nil, false), shell.Stdout(), true)
 
 	for {
 		shell.SetPrompt(cfg.GetPrompt())
@@ -18,6 +18,7 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -25,28 +26,105 @@ import (
 	"github.com/apache/cloudstack-cloudmonkey/config"
 )
 
+const apiUsage = `Usage: <API> [args...], or <verb> <noun> [args...]
+
+Runs an API, such as listVirtualMachines, also accepted as list virtualmachines.
+
+API args referencing a resource by id accept its name instead, for example
+zoneid=name:zone1, or zone=zone1 when the API has a zoneid arg. The name is
+looked up with the related list API and must match exactly one resource.
+
+Map args accept details={cpuSpeed:1000,memory:2048} for the keys of one entry,
+serviceproviderlist=[{service:Dns,provider:VirtualRouter},...] for several
+entries, and tags=env=prod,team=core for key and value pairs. List args accept
+ids=[id1,id2] as well as ids=id1,id2.
+
+Arg values are read from a file with key=@file, from stdin with key=@-, from an
+environment variable with key=@env:VAR, and base64 encoded from any of these
+with key=@base64:file, @base64:- or @base64:env:VAR, for example for userdata.
+Values are not read from stdin in the shell.
+params=@request.json loads the args of an API from a JSON object, args provided
+on the command line take precedence.
+
+Exit codes:
+  0         Success
+  1         Unclassified error
+  2         Usage error, such as an unknown command or API
+  3         Missing or invalid API parameters
+  4         Authentication failure
+  5         Network failure
+  6         API error returned by the management server
+  7         Async API job failed
+  8         Timeout
+  9         Resource waited for is in an error state or not found
+  130       Interrupted
+
+Errors are printed as JSON on stderr when the json output format is used.`
+
 var apiCommand *Command
 
+// findAPI returns the name of the API provided either by its name or as a verb
+// and noun in the leading args, along with the remaining args
+func findAPI(r *Request, args []string) (string, []string) {
+	apiName := strings.ToLower(args[0])
+	apiArgs := args[1:]
+	if r.Config.GetCache()[apiName] == nil && len(args) > 1 {
+		apiName = strings.ToLower(strings.Join(args[:2], ""))
+		apiArgs = args[2:]
+	}
+	return apiName, apiArgs
+}
+
 // GetAPIHandler returns a catchall command handler
 func GetAPIHandler() *Command {
 	return apiCommand
 }
 
+// outputKeys returns the comma separated response keys of the filter= or
+// exclude= args
+func outputKeys(args []string, prefix string) []string {
+	var keys []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			for _, key := range strings.Split(strings.Split(arg, "=")[1], ",") {
+				if len(strings.TrimSpace(key)) > 0 {
+					keys = append(keys, strings.TrimSpace(key))
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// missingArgs returns the required args of an API which are not provided
+func missingArgs(api *config.API, args []string) []string {
+	var missing []string
+	for _, required := range api.RequiredArgs {
+		required = strings.ReplaceAll(required, "=", "")
+		provided := false
+		for _, arg := range args {
+			if strings.Contains(arg, "=") && (strings.HasPrefix(arg, required) || resolvedArgName(api, strings.SplitN(arg, "=", 2)[0]) == required) {
+				provided = true
+			}
+		}
+		if !provided {
+			missing = append(missing, required)
+		}
+	}
+	return missing
+}
+
 func init() {
 	apiCommand = &Command{
-		Name: "api",
-		Help: "Runs a provided API",
+		Name:  "api",
+		Help:  "Runs a provided API",
+		Usage: apiUsage,
 		Handle: func(r *Request) error {
 			if len(r.Args) == 0 {
-				return errors.New("please provide an API to execute")
+				return newCommandError(ExitUsage, errors.New("please provide an API to execute"))
 			}
 
-			apiName := strings.ToLower(r.Args[0])
-			apiArgs := r.Args[1:]
-			if r.Config.GetCache()[apiName] == nil && len(r.Args) > 1 {
-				apiName = strings.ToLower(strings.Join(r.Args[:2], ""))
-				apiArgs = r.Args[2:]
-			}
+			apiName, apiArgs := findAPI(r, r.Args)
 
 			var uploadFiles []string
 
@@ -59,77 +137,56 @@ func init() {
 					var err error
 					uploadFiles, err = ValidateAndGetFileList(arg[len(config.FilePathArg):])
 					if err != nil {
-						return err
+						return newCommandError(ExitUsage, err)
 					}
 					if len(uploadFiles) == 0 {
-						return errors.New("no valid files to upload")
+						return newCommandError(ExitUsage, errors.New("no valid files to upload"))
 					}
 				}
 			}
 
 			api := r.Config.GetCache()[apiName]
 			if api == nil {
-				return errors.New("unknown command or API requested")
+				return newCommandError(ExitUsage, errors.New("unknown command or API requested"))
 			}
 
-			var missingArgs []string
-			for _, required := range api.RequiredArgs {
-				required = strings.ReplaceAll(required, "=", "")
-				provided := false
-				for _, arg := range apiArgs {
-					if strings.Contains(arg, "=") && strings.HasPrefix(arg, required) {
-						provided = true
-					}
-				}
-				if !provided {
-					missingArgs = append(missingArgs, strings.Replace(required, "=", "", -1))
-				}
+			apiArgs, err := expandParamsArg(r, api, apiArgs)
+			if err != nil {
+				return err
 			}
-
-			if len(missingArgs) > 0 {
-				fmt.Println("💩 Missing required parameters: ", strings.Join(missingArgs, ", "))
-				return nil
+			if len(missingArgs(api, apiArgs)) == 0 {
+				if err := checkArgs(r, api, apiArgs); err != nil {
+					return err
+				}
 			}
 
 			response, err := NewAPIRequest(r, api.Name, apiArgs, api.Async)
 			if err != nil {
-				if strings.HasSuffix(err.Error(), "context canceled") {
+				var cmdErr *CommandError
+				if r.Config.HasShell && errors.As(err, &cmdErr) && cmdErr.Details["missing"] != nil {
+					fmt.Println("💩 Missing required parameters: ", strings.Join(cmdErr.Details["missing"].([]string), ", "))
 					return nil
+				}
+				if errors.Is(err, context.Canceled) {
+					if r.Config.HasShell {
+						return nil
+					}
+					return err
 				} else if response != nil {
 					printResult(r.Config.Core.Output, response, nil, nil)
 				}
 				return err
 			}
 
-			var filterKeys []string
-			for _, arg := range apiArgs {
-				if strings.HasPrefix(arg, "filter=") {
-					for _, filterKey := range strings.Split(strings.Split(arg, "=")[1], ",") {
-						if len(strings.TrimSpace(filterKey)) > 0 {
-							filterKeys = append(filterKeys, strings.TrimSpace(filterKey))
-						}
-					}
-				}
-			}
-
-			var excludeKeys []string
-			for _, arg := range apiArgs {
-				if strings.HasPrefix(arg, "exclude=") {
-					for _, excludeKey := range strings.Split(strings.Split(arg, "=")[1], ",") {
-						if len(strings.TrimSpace(excludeKey)) > 0 {
-							excludeKeys = append(excludeKeys, strings.TrimSpace(excludeKey))
-						}
-					}
-				}
-			}
+			filterKeys := outputKeys(apiArgs, "filter=")
+			excludeKeys := outputKeys(apiArgs, "exclude=")
 
 			if len(response) > 0 {
 				printResult(r.Config.Core.Output, response, filterKeys, excludeKeys)
 				if len(uploadFiles) > 0 {
-					UploadFiles(r, api.Name, response, uploadFiles)
-				} else {
-					PromptAndUploadFilesIfNeeded(r, api.Name, response)
+					return UploadFiles(r, api.Name, response, uploadFiles)
 				}
+				return PromptAndUploadFilesIfNeeded(r, api.Name, response)
 			}
 			return nil
 		},
@@ -0,0 +1,277 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/chzyer/readline"
+)
+
+const (
+	defaultDocWidth = 80
+	minDocWidth     = 20
+	docNameWidth    = 24
+	docTypeWidth    = 8
+)
+
+// docFormats are the formats API documentation can be rendered in
+var docFormats = []string{"text", "markdown", "man"}
+
+// terminalWidth returns the width of the terminal, COLUMNS if set, or 80
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width := readline.GetScreenWidth(); width > 0 {
+		return width
+	}
+	return defaultDocWidth
+}
+
+// wrapText splits text into lines of at most width runes, breaking at spaces
+// where possible
+func wrapText(text string, width int) []string {
+	if width < minDocWidth {
+		width = minDocWidth
+	}
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if len(line) > 0 {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, string([]rune(word)[:width]))
+			word = string([]rune(word)[width:])
+		}
+		switch {
+		case len(line) == 0:
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) > width:
+			lines = append(lines, line)
+			line = word
+		default:
+			line += " " + word
+		}
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// withoutFakeArgs returns a copy of an API without the cmk only args
+func withoutFakeArgs(api *config.API) *config.API {
+	documented := *api
+	documented.Args = nil
+	for _, arg := range api.Args {
+		if arg.Type != config.FAKE {
+			documented.Args = append(documented.Args, arg)
+		}
+	}
+	return &documented
+}
+
+// argType returns the documented type of an arg
+func argType(arg *config.APIArg) string {
+	if arg.Type == config.FAKE {
+		return "cmk"
+	}
+	return arg.Type
+}
+
+func argDescription(arg *config.APIArg) string {
+	description := arg.Description
+	if arg.Required {
+		description = "(required) " + description
+	}
+	if arg.Since != "" {
+		description += " (since " + arg.Since + ")"
+	}
+	return description
+}
+
+// writeDocRow writes a row of a text documentation table, wrapping the
+// description to the width
+func writeDocRow(w io.Writer, name string, fieldType string, description string, width int, color string) {
+	indent := strings.Repeat(" ", docNameWidth+docTypeWidth+2)
+	for idx, line := range wrapText(description, width-len(indent)) {
+		if idx == 0 {
+			fmt.Fprintf(w, "\033[%sm%-*s\033[0m \033[32m%-*s\033[0m %s\n", color, docNameWidth, name, docTypeWidth, fieldType, line)
+		} else {
+			fmt.Fprintf(w, "%s%s\n", indent, line)
+		}
+	}
+}
+
+// writeAPIText writes the documentation of an API for a terminal
+func writeAPIText(w io.Writer, api *config.API, examples string, width int) {
+	description := strings.Join(wrapText(api.Description, width-len(api.Name)-2), "\n"+strings.Repeat(" ", len(api.Name)+2))
+	fmt.Fprintf(w, "\033[34m%s\033[0m: %s\n", api.Name, description)
+	if api.Since != "" {
+		fmt.Fprintf(w, "Available since %s.\n", api.Since)
+	}
+	if api.Async {
+		fmt.Fprintln(w, "This API is \033[35masynchronous\033[0m.")
+	}
+	if len(api.RequiredArgs) > 0 {
+		var required []string
+		for _, requiredArg := range api.RequiredArgs {
+			required = append(required, strings.TrimSuffix(requiredArg, "="))
+		}
+		fmt.Fprintf(w, "Required params: %s\n", strings.Join(required, ", "))
+	}
+	if args := api.Args; len(args) > 0 {
+		fmt.Fprintf(w, "\n%-*s %-*s %s\n", docNameWidth, "API Params", docTypeWidth, "Type", "Description")
+		fmt.Fprintf(w, "%-*s %-*s %s\n", docNameWidth, "==========", docTypeWidth, "====", "===========")
+		for _, arg := range args {
+			writeDocRow(w, strings.TrimSuffix(arg.Name, "="), argType(arg), argDescription(arg), width, "36")
+		}
+	}
+	if len(api.Response) > 0 {
+		fmt.Fprintf(w, "\n%-*s %-*s %s\n", docNameWidth, "Response", docTypeWidth, "Type", "Description")
+		fmt.Fprintf(w, "%-*s %-*s %s\n", docNameWidth, "========", docTypeWidth, "====", "===========")
+		for _, field := range api.Response {
+			writeDocRow(w, field.Name, field.Type, field.Description, width, "33")
+		}
+	}
+	if len(api.Related) > 0 {
+		fmt.Fprintf(w, "\nRelated APIs:\n")
+		for _, line := range wrapText(strings.Join(api.Related, ", "), width-2) {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	if examples != "" {
+		fmt.Fprintf(w, "\nExamples:\n")
+		for _, line := range strings.Split(examples, "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+}
+
+// markdownCell escapes text for a markdown table cell
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// writeAPIMarkdown writes the documentation of an API as markdown, headings
+// start at the level provided
+func writeAPIMarkdown(w io.Writer, api *config.API, examples string, level int) {
+	heading := strings.Repeat("#", level)
+	fmt.Fprintf(w, "%s %s\n\n%s\n\n", heading, api.Name, api.Description)
+	mode := "synchronous"
+	if api.Async {
+		mode = "asynchronous"
+	}
+	fmt.Fprintf(w, "This API is %s.", mode)
+	if api.Since != "" {
+		fmt.Fprintf(w, " Available since %s.", api.Since)
+	}
+	fmt.Fprintln(w)
+	if args := api.Args; len(args) > 0 {
+		fmt.Fprintf(w, "\n%s# Parameters\n\n| Name | Type | Required | Description |\n|------|------|----------|-------------|\n", heading)
+		for _, arg := range args {
+			description := arg.Description
+			if arg.Since != "" {
+				description += " (since " + arg.Since + ")"
+			}
+			fmt.Fprintf(w, "| %s | %s | %t | %s |\n", strings.TrimSuffix(arg.Name, "="), argType(arg), arg.Required, markdownCell(description))
+		}
+	}
+	if len(api.Response) > 0 {
+		fmt.Fprintf(w, "\n%s# Response\n\n| Name | Type | Description |\n|------|------|-------------|\n", heading)
+		for _, field := range api.Response {
+			fmt.Fprintf(w, "| %s | %s | %s |\n", field.Name, field.Type, markdownCell(field.Description))
+		}
+	}
+	if len(api.Related) > 0 {
+		fmt.Fprintf(w, "\n%s# Related APIs\n\n", heading)
+		for _, related := range api.Related {
+			fmt.Fprintf(w, "- %s\n", related)
+		}
+	}
+	if examples != "" {
+		fmt.Fprintf(w, "\n%s# Examples\n\n```\n%s\n```\n", heading, examples)
+	}
+}
+
+// manEscape escapes text for a man page, including control characters at the
+// start of any line
+func manEscape(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\e")
+	text = strings.ReplaceAll(text, "-", "\\-")
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[idx] = "\\&" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeAPIMan writes the documentation of an API as a man page
+func writeAPIMan(w io.Writer, api *config.API, examples string) {
+	fmt.Fprintf(w, ".TH %s 1 \"\" \"cmk\" \"CloudStack API\"\n", strings.ToUpper(api.Name))
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", api.Name, manEscape(api.Description))
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B cmk %s", api.Name)
+	for _, arg := range api.Args {
+		name := strings.TrimSuffix(arg.Name, "=")
+		if arg.Required {
+			fmt.Fprintf(w, "\n.BI %s= %s", name, argType(arg))
+		} else {
+			fmt.Fprintf(w, "\n[\\fB%s=\\fI%s\\fR]", name, argType(arg))
+		}
+	}
+	fmt.Fprintf(w, "\n.SH DESCRIPTION\n%s\n", manEscape(api.Description))
+	if api.Async {
+		fmt.Fprintln(w, ".PP\nThis API is asynchronous, cmk waits for its job to finish.")
+	}
+	if api.Since != "" {
+		fmt.Fprintf(w, ".PP\nAvailable since %s.\n", api.Since)
+	}
+	if args := api.Args; len(args) > 0 {
+		fmt.Fprintln(w, ".SH PARAMETERS")
+		for _, arg := range args {
+			fmt.Fprintf(w, ".TP\n.BR %s \" (%s)\"\n%s\n", strings.TrimSuffix(arg.Name, "="), argType(arg), manEscape(argDescription(arg)))
+		}
+	}
+	if len(api.Response) > 0 {
+		fmt.Fprintln(w, ".SH RESPONSE")
+		for _, field := range api.Response {
+			fmt.Fprintf(w, ".TP\n.BR %s \" (%s)\"\n%s\n", field.Name, field.Type, manEscape(field.Description))
+		}
+	}
+	if examples != "" {
+		fmt.Fprintf(w, ".SH EXAMPLES\n.nf\n%s\n.fi\n", manEscape(examples))
+	}
+	if len(api.Related) > 0 {
+		var related []string
+		for _, name := range api.Related {
+			related = append(related, fmt.Sprintf(".BR %s (1)", name))
+		}
+		fmt.Fprintf(w, ".SH SEE ALSO\n%s\n", strings.Join(related, ",\n"))
+	}
+}
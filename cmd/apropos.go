@@ -0,0 +1,234 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const aproposUsage = `Usage: apropos [limit=20] [format=text|json] <term>...
+
+Searches the API cache for APIs matching all the terms, ranking matches in API
+names above matches in descriptions, parameter names and descriptions, and
+response keys. For example: apropos change service offering vm`
+
+const defaultAproposLimit = 20
+
+// searchSynonyms are the terms also searched for a commonly used abbreviation
+var searchSynonyms = map[string][]string{
+	"vm":       {"virtualmachine", "virtual machine"},
+	"instance": {"virtualmachine", "virtual machine"},
+	"ip":       {"ipaddress", "ip address"},
+	"sg":       {"securitygroup", "security group"},
+	"acl":      {"networkacl"},
+	"lb":       {"loadbalancer", "load balancer"},
+	"disk":     {"volume"},
+}
+
+// searchMatch is an API matching search terms
+type searchMatch struct {
+	Name        string   `json:"name"`
+	Async       bool     `json:"isasync"`
+	Required    []string `json:"required"`
+	Description string   `json:"description"`
+	Score       int      `json:"score"`
+	MatchedBy   []string `json:"matchedby"`
+}
+
+// termScore returns how well an API matches a search term, and the fields
+// which matched, or zero if the API does not match the term
+func termScore(api *config.API, term string) (int, []string) {
+	alternatives := append([]string{term}, searchSynonyms[term]...)
+	contains := func(text string) bool {
+		text = strings.ToLower(text)
+		for _, alternative := range alternatives {
+			if strings.Contains(text, alternative) {
+				return true
+			}
+		}
+		return false
+	}
+
+	score := 0
+	var fields []string
+	name := strings.ToLower(api.Name)
+	switch {
+	case name == term:
+		score += 100
+		fields = append(fields, "name")
+	case contains(api.Noun):
+		score += 30
+		fields = append(fields, "name")
+	case contains(api.Name):
+		score += 20
+		fields = append(fields, "name")
+	}
+	if contains(api.Description) {
+		score += 10
+		fields = append(fields, "description")
+	}
+	paramName, paramDescription := false, false
+	for _, arg := range api.Args {
+		if arg.Type == config.FAKE {
+			continue
+		}
+		paramName = paramName || contains(strings.TrimSuffix(arg.Name, "="))
+		paramDescription = paramDescription || contains(arg.Description)
+	}
+	if paramName {
+		score += 5
+		fields = append(fields, "params")
+	}
+	if paramDescription {
+		score += 2
+		fields = append(fields, "param descriptions")
+	}
+	for _, key := range api.ResponseKeys {
+		if contains(strings.TrimSuffix(key, ",")) {
+			score += 3
+			fields = append(fields, "response")
+			break
+		}
+	}
+	return score, fields
+}
+
+// searchAPIs returns the APIs matching all search terms, best matches first
+func searchAPIs(apis map[string]*config.API, terms []string) []*searchMatch {
+	var matches []*searchMatch
+	for _, api := range apis {
+		match := &searchMatch{}
+		matched := make(map[string]bool)
+		for _, term := range terms {
+			score, fields := termScore(api, strings.ToLower(term))
+			if score == 0 {
+				match = nil
+				break
+			}
+			match.Score += score
+			for _, field := range fields {
+				if !matched[field] {
+					matched[field] = true
+					match.MatchedBy = append(match.MatchedBy, field)
+				}
+			}
+		}
+		if match == nil {
+			continue
+		}
+		match.Name = api.Name
+		match.Async = api.Async
+		match.Description = api.Description
+		match.Required = []string{}
+		for _, arg := range api.RequiredArgs {
+			match.Required = append(match.Required, strings.TrimSuffix(arg, "="))
+		}
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	return matches
+}
+
+// printSearchMatches prints APIs matching a search
+func printSearchMatches(matches []*searchMatch, format string) {
+	if format == "json" {
+		if matches == nil {
+			matches = []*searchMatch{}
+		}
+		output, _ := json.MarshalIndent(matches, "", "  ")
+		fmt.Println(string(output))
+		return
+	}
+	for _, match := range matches {
+		mode := "sync"
+		if match.Async {
+			mode = "\033[35masync\033[0m"
+		}
+		fmt.Printf("\033[34m%s\033[0m (%s): %s\n", match.Name, mode, match.Description)
+		if len(match.Required) > 0 {
+			fmt.Printf("    required: %s\n", strings.Join(match.Required, ", "))
+		}
+	}
+}
+
+func aproposHandler(r *Request) error {
+	limit := defaultAproposLimit
+	format := "text"
+	var terms []string
+	for _, arg := range r.Args {
+		switch {
+		case strings.HasPrefix(arg, "limit="):
+			var err error
+			if limit, err = strconv.Atoi(strings.TrimPrefix(arg, "limit=")); err != nil || limit < 1 {
+				return newCommandError(ExitUsage, fmt.Errorf("invalid limit %s", arg))
+			}
+		case strings.HasPrefix(arg, "format="):
+			format = strings.TrimPrefix(arg, "format=")
+			if format != "text" && format != "json" {
+				return newCommandError(ExitUsage, fmt.Errorf("invalid format %s, use text or json", format))
+			}
+		default:
+			terms = append(terms, strings.Fields(arg)...)
+		}
+	}
+	if len(terms) == 0 {
+		fmt.Println(aproposUsage)
+		return nil
+	}
+
+	matches := searchAPIs(r.Config.GetCache(), terms)
+	if len(matches) == 0 {
+		return newCommandError(ExitUsage, errors.New("no APIs found matching "+strings.Join(terms, " ")))
+	}
+	total := len(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	printSearchMatches(matches, format)
+	if total > limit && format != "json" {
+		fmt.Printf("Showing %d of %d matching APIs, use limit=%d to show all\n", limit, total, total)
+	}
+	return nil
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:   "apropos",
+		Help:   "Searches APIs by name, description, params and response keys",
+		Usage:  aproposUsage,
+		Handle: aproposHandler,
+	})
+	AddCommand(&Command{
+		Name:   "search",
+		Help:   "Alias of apropos",
+		Usage:  aproposUsage,
+		Handle: aproposHandler,
+	})
+}
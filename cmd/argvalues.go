@@ -0,0 +1,211 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const (
+	stdinValue        = "@-"
+	envValuePrefix    = "@env:"
+	base64ValuePrefix = "@base64:"
+	paramsArg         = "params="
+)
+
+var (
+	stdinOnce    sync.Once
+	stdinContent string
+	stdinErr     error
+)
+
+// readStdin returns the content of stdin, which is read once and shared by all
+// args using @-
+func readStdin() (string, error) {
+	stdinOnce.Do(func() {
+		var content []byte
+		content, stdinErr = io.ReadAll(os.Stdin)
+		stdinContent = strings.TrimRight(string(content), "\r\n")
+	})
+	return stdinContent, stdinErr
+}
+
+// readArgValue returns the value of an arg given as @- for stdin, @env:VAR for
+// an environment variable, @file for the content of a file or @base64:<source>
+// for the base64 encoded content of any of these sources, other values are
+// returned as is
+func readArgValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, base64ValuePrefix):
+		source := strings.TrimPrefix(value, base64ValuePrefix)
+		var content string
+		var err error
+		if source == "-" || strings.HasPrefix(source, "env:") {
+			content, err = readArgValue("@" + source)
+		} else {
+			var bytes []byte
+			bytes, err = os.ReadFile(source)
+			content = string(bytes)
+		}
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString([]byte(content)), nil
+	case value == stdinValue:
+		return readStdin()
+	case strings.HasPrefix(value, envValuePrefix):
+		name := strings.TrimPrefix(value, envValuePrefix)
+		content, found := os.LookupEnv(name)
+		if !found {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return content, nil
+	case strings.HasPrefix(value, "@"):
+		fileName := value[1:]
+		if fileInfo, err := os.Stat(fileName); err == nil && !fileInfo.IsDir() {
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				return "", err
+			}
+			return string(content), nil
+		}
+	}
+	return value, nil
+}
+
+// checkStdinValue refuses values read from stdin in the shell, where stdin is
+// the input of the shell
+func checkStdinValue(r *Request, value string) error {
+	if r.Config.HasShell && (value == stdinValue || value == base64ValuePrefix+"-") {
+		return newCommandError(ExitUsage, errors.New("values can not be read from stdin with @- in the shell"))
+	}
+	return nil
+}
+
+// jsonArgs returns the args for a JSON value of an arg, objects and lists of
+// objects become indexed map args such as details[0].cpuSpeed=1000
+func jsonArgs(name string, value interface{}) []string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return jsonArgs(name, []interface{}{value})
+	case []interface{}:
+		var args, items []string
+		for idx, item := range value {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				items = append(items, jsonify(item, "text"))
+				continue
+			}
+			var keys []string
+			for key := range entry {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				args = append(args, fmt.Sprintf("%s[%d].%s=%s", name, idx, key, jsonify(entry[key], "text")))
+			}
+		}
+		if len(items) > 0 {
+			args = append(args, name+"="+strings.Join(items, ","))
+		}
+		return args
+	case nil:
+		return nil
+	}
+	return []string{name + "=" + jsonify(value, "text")}
+}
+
+// expandParamsArg replaces a params=@request.json arg with the args of the
+// JSON object it loads, args provided on the command line take precedence
+func expandParamsArg(r *Request, api *config.API, args []string) ([]string, error) {
+	if api != nil && api.HasArg(paramsArg) {
+		return args, nil
+	}
+	var expanded []string
+	provided := make(map[string]bool)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, paramsArg) {
+			provided[strings.SplitN(arg, "=", 2)[0]] = true
+		}
+	}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, paramsArg) {
+			expanded = append(expanded, arg)
+			continue
+		}
+		source := strings.TrimPrefix(arg, paramsArg)
+		if err := checkStdinValue(r, source); err != nil {
+			return nil, err
+		}
+		content, err := readArgValue(source)
+		if err != nil {
+			return nil, newCommandError(ExitUsage, fmt.Errorf("failed to read params: %v", err))
+		}
+		var params map[string]interface{}
+		if err := json.Unmarshal([]byte(content), &params); err != nil {
+			return nil, newCommandError(ExitUsage, fmt.Errorf("failed to parse params, a JSON object is required: %v", err))
+		}
+		var keys []string
+		for key := range params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !provided[key] {
+				expanded = append(expanded, jsonArgs(key, params[key])...)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// expandArgValues reads the values of args from stdin, environment variables
+// and files, values are only base64 encoded with the @base64: prefix
+func expandArgValues(r *Request, args []string) ([]string, error) {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "@") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		key := parts[0]
+		if err := checkStdinValue(r, parts[1]); err != nil {
+			return nil, err
+		}
+		value, err := readArgValue(parts[1])
+		if err != nil {
+			return nil, newCommandError(ExitUsage, fmt.Errorf("failed to read value of %s: %v", key, err))
+		}
+		if value != parts[1] {
+			config.Debug("Value of argument ", key, " read from ", parts[1])
+		}
+		expanded = append(expanded, key+"="+value)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,347 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apache/cloudstack-cloudmonkey/pkg/client"
+)
+
+const batchUsage = `Usage: batch [workers=N] [rate=N] [output=<file.csv>] <file.csv|file.jsonl> <API> [args...]
+
+Runs an API once for each row of a CSV file, whose header row names the API
+parameters, or of a JSON lines file of parameter objects. The provided args are
+used for every row unless the row sets them. Resources can be named as in API
+args, for example with a zone column or zoneid=name:zone1.
+At most rate API calls are started per second when rate is set. The result of
+each row is written to output, <file>-result.csv by default.`
+
+type batchOptions struct {
+	workers int
+	rate    float64
+	output  string
+}
+
+type batchRow struct {
+	params map[string]string
+	order  []string
+}
+
+func parseBatchOptions(args []string) (batchOptions, []string, error) {
+	opts := batchOptions{workers: defaultForeachWorkers}
+	for len(args) > 0 {
+		var err error
+		switch {
+		case strings.HasPrefix(args[0], "workers="):
+			opts.workers, err = strconv.Atoi(strings.TrimPrefix(args[0], "workers="))
+			if err == nil && opts.workers < 1 {
+				err = errors.New("workers must be positive")
+			}
+		case strings.HasPrefix(args[0], "rate="):
+			opts.rate, err = strconv.ParseFloat(strings.TrimPrefix(args[0], "rate="), 64)
+		case strings.HasPrefix(args[0], "output="):
+			opts.output = strings.TrimPrefix(args[0], "output=")
+		default:
+			return opts, args, nil
+		}
+		if err != nil {
+			return opts, nil, fmt.Errorf("invalid option %s: %v", args[0], err)
+		}
+		args = args[1:]
+	}
+	return opts, args, nil
+}
+
+func readBatchCSV(file *os.File) ([]batchRow, error) {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	header := records[0]
+	var rows []batchRow
+	for _, record := range records[1:] {
+		row := batchRow{params: make(map[string]string)}
+		for idx, value := range record {
+			if idx < len(header) && len(value) > 0 {
+				key := strings.TrimSpace(header[idx])
+				row.params[key] = value
+				row.order = append(row.order, key)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func readBatchJSONLines(file *os.File) ([]batchRow, error) {
+	var rows []batchRow
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 {
+			continue
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &values); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %v", line, err)
+		}
+		var keys []string
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		row := batchRow{params: make(map[string]string)}
+		for _, key := range keys {
+			// objects become indexed map args as with params=@file
+			for _, arg := range jsonArgs(key, values[key]) {
+				parts := strings.SplitN(arg, "=", 2)
+				row.params[parts[0]] = parts[1]
+				row.order = append(row.order, parts[0])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// readBatchRows reads API parameters per row from a CSV or JSON lines file
+func readBatchRows(fileName string) ([]batchRow, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".jsonl", ".ndjson", ".json":
+		return readBatchJSONLines(file)
+	}
+	return readBatchCSV(file)
+}
+
+// batchArgName returns the name of an arg without the index and key of map
+// args such as details[0].cpuSpeed
+func batchArgName(key string) string {
+	return strings.SplitN(key, "[", 2)[0]
+}
+
+// batchArgs returns the API args for a row, row values override the default args
+func batchArgs(defaults []string, row batchRow) []string {
+	provided := make(map[string]bool)
+	for _, key := range row.order {
+		provided[batchArgName(key)] = true
+	}
+	var args []string
+	for _, arg := range defaults {
+		if !provided[batchArgName(strings.SplitN(arg, "=", 2)[0])] {
+			args = append(args, arg)
+		}
+	}
+	for _, key := range row.order {
+		args = append(args, key+"="+row.params[key])
+	}
+	return args
+}
+
+// batchResultColumns returns the names of the result columns, which are
+// prefixed with result_ when an input column has the same name
+func batchResultColumns(rows []batchRow) map[string]string {
+	input := make(map[string]bool)
+	for _, row := range rows {
+		for _, key := range row.order {
+			input[key] = true
+		}
+	}
+	columns := make(map[string]string)
+	for _, name := range []string{"row", "status", "resourceid", "jobid", "error"} {
+		column := name
+		for input[column] {
+			column = "result_" + column
+		}
+		columns[name] = column
+	}
+	return columns
+}
+
+// responseResourceID returns the id of the resource in an API response
+func responseResourceID(response map[string]interface{}) string {
+	if id, ok := response["id"]; ok {
+		return fmt.Sprint(id)
+	}
+	for _, value := range response {
+		if resource, ok := value.(map[string]interface{}); ok && resource["id"] != nil {
+			return fmt.Sprint(resource["id"])
+		}
+	}
+	return ""
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "batch",
+		Help:  "Runs an API for each row of a CSV or JSON lines file",
+		Usage: batchUsage,
+		Handle: func(r *Request) error {
+			opts, args, err := parseBatchOptions(r.Args)
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+			if len(args) < 2 {
+				fmt.Println(batchUsage)
+				return nil
+			}
+			inputFile := args[0]
+			apiName, defaults := findAPI(r, args[1:])
+			api := r.Config.GetCache()[apiName]
+			if api == nil {
+				return newCommandError(ExitUsage, errors.New("unknown command or API requested"))
+			}
+			rows, err := readBatchRows(inputFile)
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+			if len(rows) == 0 {
+				fmt.Println("No rows to run", api.Name, "for in", inputFile)
+				return nil
+			}
+			if defaults, err = expandParamsArg(r, api, defaults); err != nil {
+				return err
+			}
+			rowArgs := make([][]string, len(rows))
+			for idx, row := range rows {
+				rowArgs[idx] = batchArgs(defaults, row)
+			}
+			if err := checkArgs(r, api, rowArgs...); err != nil {
+				return err
+			}
+			if opts.output == "" {
+				opts.output = strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + "-result.csv"
+			}
+
+			ctx := requestContext(r)
+			profile := r.Config.ActiveProfile
+			if profile.APIKey == "" || profile.SecretKey == "" {
+				if _, err := NewClient(r).Login(ctx); err != nil {
+					return err
+				}
+			}
+
+			columns := batchResultColumns(rows)
+			results := make([]map[string]interface{}, len(rows))
+			errs := make([]error, len(rows))
+			header := []string{columns["row"]}
+			seen := make(map[string]bool)
+			for idx, row := range rows {
+				results[idx] = map[string]interface{}{
+					columns["row"]:        idx + 1,
+					columns["status"]:     "skipped",
+					columns["resourceid"]: "",
+					columns["jobid"]:      "",
+					columns["error"]:      "",
+				}
+				for _, key := range row.order {
+					results[idx][key] = row.params[key]
+					if !seen[key] {
+						seen[key] = true
+						header = append(header, key)
+					}
+				}
+			}
+			header = append(header, columns["status"], columns["resourceid"], columns["jobid"], columns["error"])
+
+			var done int32
+			waiter := r.Config.StartSpinner(fmt.Sprintf("running %s for %d rows...", api.Name, len(rows)))
+			worker := r.WithProgress(func(message string) {
+				r.Config.UpdateSpinner(waiter, fmt.Sprintf("running %s, finished %d/%d rows, %s", api.Name, atomic.LoadInt32(&done), len(rows), message))
+			})
+			runWorkers(ctx, len(rows), opts.workers, opts.rate, func(idx int) {
+				result := results[idx]
+				response, err := apiRequest(ctx, worker, api.Name, rowArgs[idx], api.Async)
+				result[columns["status"]] = "success"
+				result[columns["resourceid"]] = responseResourceID(response)
+				if jobID, ok := response["jobid"].(string); ok {
+					result[columns["jobid"]] = jobID
+				}
+				if err != nil {
+					result[columns["status"]] = "failed"
+					result[columns["error"]] = err.Error()
+					errs[idx] = err
+					var jobErr *client.AsyncJobError
+					if errors.As(err, &jobErr) {
+						result[columns["jobid"]] = jobErr.JobID
+					}
+				}
+				finished := atomic.AddInt32(&done, 1)
+				r.Config.UpdateSpinner(waiter, fmt.Sprintf("running %s, finished %d/%d rows...", api.Name, finished, len(rows)))
+			})
+			r.Config.StopSpinner(waiter)
+
+			output, err := os.Create(opts.output)
+			if err != nil {
+				return err
+			}
+			items := make([]interface{}, len(results))
+			for idx, result := range results {
+				items[idx] = result
+			}
+			err = writeCsv(output, map[string]interface{}{"results": items}, header)
+			if closeErr := output.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %v", opts.output, err)
+			}
+
+			var firstErr error
+			failed := 0
+			for _, err := range errs {
+				if err != nil {
+					failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+			}
+			fmt.Printf("Ran %s for %d rows, %d failed, results written to %s\n", api.Name, len(rows), failed, opts.output)
+
+			if ctx.Err() != nil {
+				if r.Config.HasShell {
+					return nil
+				}
+				return ctx.Err()
+			}
+			if failed > 0 {
+				return newCommandError(ExitCode(firstErr), fmt.Errorf("%d out of %d %s calls failed", failed, len(rows), api.Name))
+			}
+			return nil
+		},
+	})
+}
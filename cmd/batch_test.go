@@ -0,0 +1,94 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return fileName
+}
+
+func TestReadBatchRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    [][]string
+		valid   bool
+	}{
+		{"vms.csv", "name, zoneid\nvm-1,zone-1\nvm-2,\n", [][]string{{"name=vm-1", "zoneid=zone-1"}, {"name=vm-2"}}, true},
+		{"vms.jsonl", `{"name":"vm-1","details":{"cpuSpeed":1000,"memory":2048}}` + "\n\n" + `{"name":"vm-2","size":1.5,"ids":["a","b"]}`, [][]string{
+			{"details[0].cpuSpeed=1000", "details[0].memory=2048", "name=vm-1"},
+			{"ids=a,b", "name=vm-2", "size=1.5"},
+		}, true},
+		{"tags.jsonl", `{"tags":[{"key":"env","value":"prod"},{"key":"team","value":"core"}],"empty":null}`, [][]string{
+			{"tags[0].key=env", "tags[0].value=prod", "tags[1].key=team", "tags[1].value=core"},
+		}, true},
+		{"bad.jsonl", `{"name":"vm-1"}` + "\n" + `["vm-2"]`, nil, false},
+	}
+	for _, test := range tests {
+		rows, err := readBatchRows(writeTestFile(t, test.name, test.content))
+		if (err == nil) != test.valid {
+			t.Errorf("readBatchRows(%s) = %v, expected valid %v", test.name, err, test.valid)
+			continue
+		}
+		var args [][]string
+		for _, row := range rows {
+			args = append(args, batchArgs(nil, row))
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("readBatchRows(%s) = %q, expected %q", test.name, args, test.args)
+		}
+	}
+}
+
+func TestBatchArgs(t *testing.T) {
+	row := batchRow{
+		params: map[string]string{"name": "vm-1", "details[0].cpuSpeed": "1000"},
+		order:  []string{"details[0].cpuSpeed", "name"},
+	}
+	defaults := []string{"zoneid=zone-1", "name=default", "details[0].memory=2048"}
+	expected := []string{"zoneid=zone-1", "details[0].cpuSpeed=1000", "name=vm-1"}
+	if args := batchArgs(defaults, row); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected row values to override the default args, got %q", args)
+	}
+}
+
+func TestBatchResultColumns(t *testing.T) {
+	rows := []batchRow{{order: []string{"name", "status"}}, {order: []string{"error", "result_error"}}}
+	columns := batchResultColumns(rows)
+	expected := map[string]string{
+		"row":        "row",
+		"status":     "result_status",
+		"resourceid": "resourceid",
+		"jobid":      "jobid",
+		"error":      "result_result_error",
+	}
+	if !reflect.DeepEqual(columns, expected) {
+		t.Errorf("expected result columns %v, got %v", expected, columns)
+	}
+}
@@ -25,6 +25,7 @@ import (
 type Command struct {
 	Name            string
 	Help            string
+	Usage           string
 	SubCommands     map[string][]string
 	CustomCompleter func(input string, position int)
 	Handle          func(*Request) error
@@ -72,8 +73,14 @@ Allowed flags:
   -u	    CloudStack's API endpoint URL
   -s	    CloudStack user's secret Key
   -k	    CloudStack user's API Key
+  -mock     Use an in-process mock management server for offline testing
+  -record   Record API requests and responses (secrets scrubbed) to a file
+  -replay   Serve API responses from a file recorded with -record
+  -trace    Trace API request timings to a HAR file, use - for a summary only
 
 Default commands:
 %s
+Run help <command> for the usage of a command, for example help api for the
+syntax of API args and the exit codes.
 `, commandHelp)
 }
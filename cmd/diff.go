@@ -0,0 +1,324 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const diffUsage = `Usage: diff <old> <new> [apis=<api1,api2,...>] [format=text|json|markdown]
+
+Compares two API caches and reports the APIs added and removed, and for the
+APIs in both the changed async flag, and the added, removed and changed
+parameters and response keys. A cache is either the name of a server profile,
+inbuilt for the API cache shipped with cmk, or the path of an API cache file or
+listApis JSON response. The apis arg limits the report to the listed APIs.`
+
+// apiChanges describes how an API changed between two API caches
+type apiChanges struct {
+	Name                string   `json:"name"`
+	Async               string   `json:"async,omitempty"`
+	AddedParams         []string `json:"addedparams,omitempty"`
+	RemovedParams       []string `json:"removedparams,omitempty"`
+	ChangedParams       []string `json:"changedparams,omitempty"`
+	AddedResponseKeys   []string `json:"addedresponsekeys,omitempty"`
+	RemovedResponseKeys []string `json:"removedresponsekeys,omitempty"`
+}
+
+// cacheDiff describes the differences between two API caches
+type cacheDiff struct {
+	Old     string       `json:"old"`
+	New     string       `json:"new"`
+	Added   []string     `json:"added"`
+	Removed []string     `json:"removed"`
+	Changed []apiChanges `json:"changed"`
+}
+
+// readAPICache reads the APIs of a profile, the inbuilt API cache or an API
+// cache file
+func readAPICache(r *Request, source string) (map[string]*config.API, error) {
+	var data map[string]interface{}
+	if source == "inbuilt" {
+		data = config.GetBundledAPICache()
+	} else {
+		fileName := source
+		if config.CheckIfValuePresent(config.GetProfiles(), source) {
+			fileName = r.Config.ProfileCacheFile(source)
+		}
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", fileName, err)
+		}
+	}
+	if response, ok := data["listapisresponse"].(map[string]interface{}); ok {
+		data = response
+	}
+	if _, ok := data["api"].([]interface{}); !ok {
+		return nil, fmt.Errorf("no APIs found in %s", source)
+	}
+	apis, err := config.ParseAPICache(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", source, err)
+	}
+	return apis, nil
+}
+
+// apiParams returns the args of an API other than cmk's own args, by name
+func apiParams(api *config.API) map[string]*config.APIArg {
+	params := make(map[string]*config.APIArg)
+	for _, arg := range api.Args {
+		if arg.Type != config.FAKE {
+			params[strings.TrimSuffix(arg.Name, "=")] = arg
+		}
+	}
+	return params
+}
+
+// setDiff returns the sorted keys of a which are not in b
+func setDiff(a map[string]bool, b map[string]bool) []string {
+	var keys []string
+	for key := range a {
+		if !b[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func compareAPIs(oldAPI *config.API, newAPI *config.API) apiChanges {
+	changes := apiChanges{Name: newAPI.Name}
+	if oldAPI.Async != newAPI.Async {
+		changes.Async = fmt.Sprintf("%v -> %v", oldAPI.Async, newAPI.Async)
+	}
+
+	oldParams, newParams := apiParams(oldAPI), apiParams(newAPI)
+	oldNames, newNames := make(map[string]bool), make(map[string]bool)
+	for name := range oldParams {
+		oldNames[name] = true
+	}
+	for name := range newParams {
+		newNames[name] = true
+	}
+	changes.AddedParams = setDiff(newNames, oldNames)
+	changes.RemovedParams = setDiff(oldNames, newNames)
+	for _, name := range setDiff(newNames, nil) {
+		oldArg, found := oldParams[name]
+		if !found {
+			continue
+		}
+		newArg := newParams[name]
+		if oldArg.Required != newArg.Required {
+			if newArg.Required {
+				changes.ChangedParams = append(changes.ChangedParams, name+" is now required")
+			} else {
+				changes.ChangedParams = append(changes.ChangedParams, name+" is now optional")
+			}
+		}
+		if oldArg.Type != newArg.Type {
+			changes.ChangedParams = append(changes.ChangedParams, fmt.Sprintf("%s type changed from %s to %s", name, oldArg.Type, newArg.Type))
+		}
+	}
+
+	oldKeys, newKeys := make(map[string]bool), make(map[string]bool)
+	for _, key := range oldAPI.ResponseKeys {
+		oldKeys[strings.TrimSuffix(key, ",")] = true
+	}
+	for _, key := range newAPI.ResponseKeys {
+		newKeys[strings.TrimSuffix(key, ",")] = true
+	}
+	changes.AddedResponseKeys = setDiff(newKeys, oldKeys)
+	changes.RemovedResponseKeys = setDiff(oldKeys, newKeys)
+	return changes
+}
+
+func (c apiChanges) empty() bool {
+	return c.Async == "" && len(c.AddedParams) == 0 && len(c.RemovedParams) == 0 && len(c.ChangedParams) == 0 &&
+		len(c.AddedResponseKeys) == 0 && len(c.RemovedResponseKeys) == 0
+}
+
+// diffAPICaches compares two API caches, limited to the named APIs if any
+func diffAPICaches(oldCache map[string]*config.API, newCache map[string]*config.API, apis []string) cacheDiff {
+	diff := cacheDiff{Added: []string{}, Removed: []string{}, Changed: []apiChanges{}}
+	selected := func(name string) bool {
+		if len(apis) == 0 {
+			return true
+		}
+		for _, api := range apis {
+			if strings.EqualFold(api, name) {
+				return true
+			}
+		}
+		return false
+	}
+	var names []string
+	for name := range newCache {
+		names = append(names, name)
+	}
+	for name := range oldCache {
+		if newCache[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		oldAPI, newAPI := oldCache[name], newCache[name]
+		switch {
+		case !selected(name):
+		case oldAPI == nil:
+			diff.Added = append(diff.Added, newAPI.Name)
+		case newAPI == nil:
+			diff.Removed = append(diff.Removed, oldAPI.Name)
+		default:
+			if changes := compareAPIs(oldAPI, newAPI); !changes.empty() {
+				diff.Changed = append(diff.Changed, changes)
+			}
+		}
+	}
+	return diff
+}
+
+// changeLines returns the changes of an API as pairs of a + for additions, -
+// for removals or ~ for changes, and the description of the change
+func (c apiChanges) changeLines() [][2]string {
+	var lines [][2]string
+	if c.Async != "" {
+		lines = append(lines, [2]string{"~", "async " + c.Async})
+	}
+	for _, name := range c.AddedParams {
+		lines = append(lines, [2]string{"+", "param " + name})
+	}
+	for _, name := range c.RemovedParams {
+		lines = append(lines, [2]string{"-", "param " + name})
+	}
+	for _, change := range c.ChangedParams {
+		lines = append(lines, [2]string{"~", "param " + change})
+	}
+	for _, key := range c.AddedResponseKeys {
+		lines = append(lines, [2]string{"+", "response key " + key})
+	}
+	for _, key := range c.RemovedResponseKeys {
+		lines = append(lines, [2]string{"-", "response key " + key})
+	}
+	return lines
+}
+
+// markdownChangeKinds names the kinds of changes in markdown reports
+var markdownChangeKinds = map[string]string{"+": "Added", "-": "Removed", "~": "Changed"}
+
+func printMarkdownList(w io.Writer, names []string) {
+	if len(names) == 0 {
+		fmt.Fprintln(w, "None")
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "- `%s`\n", name)
+	}
+}
+
+func printDiff(w io.Writer, diff cacheDiff, format string) {
+	switch format {
+	case "json":
+		output, _ := json.MarshalIndent(diff, "", "  ")
+		fmt.Fprintln(w, string(output))
+	case "markdown":
+		fmt.Fprintf(w, "# API changes from %s to %s\n", diff.Old, diff.New)
+		fmt.Fprintf(w, "\n## Added APIs (%d)\n\n", len(diff.Added))
+		printMarkdownList(w, diff.Added)
+		fmt.Fprintf(w, "\n## Removed APIs (%d)\n\n", len(diff.Removed))
+		printMarkdownList(w, diff.Removed)
+		fmt.Fprintf(w, "\n## Changed APIs (%d)\n", len(diff.Changed))
+		for _, changes := range diff.Changed {
+			fmt.Fprintf(w, "\n### %s\n\n", changes.Name)
+			for _, line := range changes.changeLines() {
+				fmt.Fprintf(w, "- %s %s\n", markdownChangeKinds[line[0]], line[1])
+			}
+		}
+	default:
+		fmt.Fprintf(w, "API changes from %s to %s\n", diff.Old, diff.New)
+		fmt.Fprintf(w, "\nAdded APIs (%d):\n", len(diff.Added))
+		for _, name := range diff.Added {
+			fmt.Fprintf(w, "  + %s\n", name)
+		}
+		fmt.Fprintf(w, "\nRemoved APIs (%d):\n", len(diff.Removed))
+		for _, name := range diff.Removed {
+			fmt.Fprintf(w, "  - %s\n", name)
+		}
+		fmt.Fprintf(w, "\nChanged APIs (%d):\n", len(diff.Changed))
+		for _, changes := range diff.Changed {
+			fmt.Fprintf(w, "  %s\n", changes.Name)
+			for _, line := range changes.changeLines() {
+				fmt.Fprintf(w, "    %s %s\n", line[0], line[1])
+			}
+		}
+	}
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "diff",
+		Help:  "Compares two API caches, such as of profiles or server versions",
+		Usage: diffUsage,
+		Handle: func(r *Request) error {
+			var sources, apis []string
+			format := "text"
+			for _, arg := range r.Args {
+				switch {
+				case strings.HasPrefix(arg, "apis="):
+					apis = strings.Split(strings.TrimPrefix(arg, "apis="), ",")
+				case strings.HasPrefix(arg, "format="):
+					format = strings.TrimPrefix(arg, "format=")
+					if !config.CheckIfValuePresent([]string{"text", "json", "markdown"}, format) {
+						return newCommandError(ExitUsage, fmt.Errorf("invalid format %s, use text, json or markdown", format))
+					}
+				default:
+					sources = append(sources, arg)
+				}
+			}
+			if len(sources) != 2 {
+				fmt.Println(diffUsage)
+				if len(sources) == 0 {
+					return nil
+				}
+				return newCommandError(ExitUsage, errors.New("please provide the old and new API caches to compare"))
+			}
+			oldCache, err := readAPICache(r, sources[0])
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+			newCache, err := readAPICache(r, sources[1])
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+			diff := diffAPICaches(oldCache, newCache, apis)
+			diff.Old, diff.New = sources[0], sources[1]
+			printDiff(os.Stdout, diff, format)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+// parseTestCache returns the APIs of a listApis response in JSON
+func parseTestCache(t *testing.T, content string) map[string]*config.API {
+	t.Helper()
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &response); err != nil {
+		t.Fatalf("invalid test API cache: %v", err)
+	}
+	apis, err := config.ParseAPICache(response)
+	if err != nil {
+		t.Fatalf("failed to parse test API cache: %v", err)
+	}
+	return apis
+}
+
+const oldTestCache = `{"api": [
+	{"name": "listZones", "isasync": false, "params": [
+		{"name": "id", "type": "uuid"},
+		{"name": "available", "type": "boolean"}
+	], "response": [{"name": "id"}, {"name": "name"}, {"name": "dns1"}]},
+	{"name": "deployVirtualMachine", "isasync": true, "params": [
+		{"name": "zoneid", "type": "uuid", "required": true},
+		{"name": "size", "type": "integer"},
+		{"name": "hostid", "type": "uuid"}
+	], "response": [{"name": "id"}]},
+	{"name": "listPods", "isasync": false}
+]}`
+
+const newTestCache = `{"api": [
+	{"name": "listZones", "isasync": false, "params": [
+		{"name": "id", "type": "uuid"},
+		{"name": "available", "type": "boolean"}
+	], "response": [{"name": "id"}, {"name": "name"}, {"name": "dns1"}]},
+	{"name": "deployVirtualMachine", "isasync": false, "params": [
+		{"name": "zoneid", "type": "uuid", "required": false},
+		{"name": "size", "type": "long"},
+		{"name": "userdata", "type": "string"}
+	], "response": [{"name": "id"}, {"name": "userdata"}]},
+	{"name": "listClusters", "isasync": false}
+]}`
+
+func TestCompareAPIs(t *testing.T) {
+	oldCache, newCache := parseTestCache(t, oldTestCache), parseTestCache(t, newTestCache)
+	changes := compareAPIs(oldCache["deployvirtualmachine"], newCache["deployvirtualmachine"])
+	expected := apiChanges{
+		Name:              "deployVirtualMachine",
+		Async:             "true -> false",
+		AddedParams:       []string{"userdata"},
+		RemovedParams:     []string{"hostid"},
+		ChangedParams:     []string{"size type changed from integer to long", "zoneid is now optional"},
+		AddedResponseKeys: []string{"userdata"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected changes %+v, got %+v", expected, changes)
+	}
+	if changes := compareAPIs(oldCache["listzones"], newCache["listzones"]); !changes.empty() {
+		t.Errorf("expected no changes of an unchanged API, got %+v", changes)
+	}
+}
+
+func TestDiffAPICaches(t *testing.T) {
+	oldCache, newCache := parseTestCache(t, oldTestCache), parseTestCache(t, newTestCache)
+	tests := []struct {
+		apis    []string
+		added   []string
+		removed []string
+		changed []string
+	}{
+		{nil, []string{"listClusters"}, []string{"listPods"}, []string{"deployVirtualMachine"}},
+		{[]string{"listpods", "listZones"}, []string{}, []string{"listPods"}, nil},
+		{[]string{"unknownApi"}, []string{}, []string{}, nil},
+	}
+	for _, test := range tests {
+		diff := diffAPICaches(oldCache, newCache, test.apis)
+		var changed []string
+		for _, changes := range diff.Changed {
+			changed = append(changed, changes.Name)
+		}
+		if !reflect.DeepEqual(diff.Added, test.added) || !reflect.DeepEqual(diff.Removed, test.removed) || !reflect.DeepEqual(changed, test.changed) {
+			t.Errorf("diff of %v: expected added %v, removed %v, changed %v, got %v, %v, %v",
+				test.apis, test.added, test.removed, test.changed, diff.Added, diff.Removed, changed)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const docsUsage = `Usage: docs format=man|markdown|html [source=<profile|inbuilt|file>] [apis=<api1,api2,...>] <output>
+
+Renders the documentation of the APIs in an API cache, including the cmk args
+such as filter= and filepath=. The cache is the one of the active profile
+unless source names a server profile, inbuilt for the API cache shipped with
+cmk, or an API cache file. The man format writes a man page per API to the
+output directory, markdown writes a README.md index and a page per API in a
+directory per noun, and html writes a single page to the output file, or to
+stdout when the output is -. The apis arg limits the documentation to the
+listed APIs.`
+
+// docGroup is the APIs of a noun
+type docGroup struct {
+	Noun string
+	APIs []*config.API
+}
+
+// groupAPIsByNoun returns the APIs grouped and sorted by noun, then by name
+func groupAPIsByNoun(apis map[string]*config.API, names []string) []docGroup {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[strings.ToLower(name)] = true
+	}
+	byNoun := make(map[string][]*config.API)
+	for key, api := range apis {
+		if len(selected) > 0 && !selected[key] {
+			continue
+		}
+		// APIs such as login have no noun and are grouped by their name
+		noun := api.Noun
+		if noun == "" {
+			noun = key
+		}
+		byNoun[noun] = append(byNoun[noun], api)
+	}
+	var groups []docGroup
+	for noun, nounAPIs := range byNoun {
+		sort.Slice(nounAPIs, func(i, j int) bool {
+			return nounAPIs[i].Name < nounAPIs[j].Name
+		})
+		groups = append(groups, docGroup{Noun: noun, APIs: nounAPIs})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Noun < groups[j].Noun
+	})
+	return groups
+}
+
+// writeDocFile creates a documentation file and writes it with a renderer, the
+// output is buffered so that failed writes are reported when it is flushed
+func writeDocFile(fileName string, render func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	err = render(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// warnUnknownAPIs warns about the listed APIs which are not in an API cache
+func warnUnknownAPIs(apis map[string]*config.API, names []string) {
+	for _, name := range names {
+		if apis[strings.ToLower(name)] == nil {
+			fmt.Fprintln(os.Stderr, "Warning: API", name, "is not in the API cache")
+		}
+	}
+}
+
+// writeManDocs writes a man page per API to a directory
+func writeManDocs(r *Request, groups []docGroup, dir string) (int, error) {
+	count := 0
+	for _, group := range groups {
+		for _, api := range group.APIs {
+			examples := r.Config.APIExamples(api.Name)
+			err := writeDocFile(filepath.Join(dir, api.Name+".1"), func(w io.Writer) error {
+				writeAPIMan(w, api, examples)
+				return nil
+			})
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// writeMarkdownDocs writes an index and a markdown page per API, in a directory
+// per noun
+func writeMarkdownDocs(r *Request, groups []docGroup, dir string) (int, error) {
+	count := 0
+	for _, group := range groups {
+		for _, api := range group.APIs {
+			examples := r.Config.APIExamples(api.Name)
+			err := writeDocFile(filepath.Join(dir, group.Noun, api.Name+".md"), func(w io.Writer) error {
+				writeAPIMarkdown(w, api, examples, 1)
+				return nil
+			})
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	err := writeDocFile(filepath.Join(dir, "README.md"), func(w io.Writer) error {
+		fmt.Fprintf(w, "# CloudStack APIs\n")
+		for _, group := range groups {
+			fmt.Fprintf(w, "\n## %s\n\n", group.Noun)
+			for _, api := range group.APIs {
+				fmt.Fprintf(w, "- [%s](%s/%s.md): %s\n", api.Name, group.Noun, api.Name, markdownCell(api.Description))
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+var htmlDocsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"trimEq":  func(name string) string { return strings.TrimSuffix(name, "=") },
+	"argType": argType,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CloudStack APIs</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+code, pre { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>CloudStack APIs</h1>
+<nav>
+{{- range .Groups}}
+<h3>{{.Noun}}</h3>
+<ul>{{range .APIs}}<li><a href="#{{.Name}}">{{.Name}}</a></li>{{end}}</ul>
+{{- end}}
+</nav>
+{{- range .Groups}}{{range .APIs}}
+<section id="{{.Name}}">
+<h2>{{.Name}}</h2>
+<p>{{.Description}}</p>
+<p>This API is {{if .Async}}asynchronous{{else}}synchronous{{end}}.{{if .Since}} Available since {{.Since}}.{{end}}</p>
+{{- if .Args}}
+<table>
+<tr><th>Parameter</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{- range .Args}}
+<tr><td><code>{{trimEq .Name}}</code></td><td>{{argType .}}</td><td>{{.Required}}</td><td>{{.Description}}{{if .Since}} (since {{.Since}}){{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Response}}
+<table>
+<tr><th>Response</th><th>Type</th><th>Description</th></tr>
+{{- range .Response}}
+<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Related}}
+<p>Related APIs: {{range $idx, $name := .Related}}{{if $idx}}, {{end}}<a href="#{{$name}}">{{$name}}</a>{{end}}</p>
+{{- end}}
+{{- with index $.Examples .Name}}
+<pre>{{.}}</pre>
+{{- end}}
+</section>
+{{- end}}{{end}}
+</body>
+</html>
+`))
+
+// writeHTMLDocs writes the documentation of the APIs as a single HTML page
+func writeHTMLDocs(r *Request, groups []docGroup, w io.Writer) (int, error) {
+	count := 0
+	examples := make(map[string]string)
+	for _, group := range groups {
+		for _, api := range group.APIs {
+			examples[api.Name] = r.Config.APIExamples(api.Name)
+			count++
+		}
+	}
+	return count, htmlDocsTemplate.Execute(w, map[string]interface{}{"Groups": groups, "Examples": examples})
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "docs",
+		Help:  "Renders API documentation as man pages, markdown or HTML",
+		Usage: docsUsage,
+		Handle: func(r *Request) error {
+			var format, source, output string
+			var apis []string
+			for _, arg := range r.Args {
+				switch {
+				case strings.HasPrefix(arg, "format="):
+					format = strings.TrimPrefix(arg, "format=")
+				case strings.HasPrefix(arg, "source="):
+					source = strings.TrimPrefix(arg, "source=")
+				case strings.HasPrefix(arg, "apis="):
+					apis = strings.Split(strings.TrimPrefix(arg, "apis="), ",")
+				case strings.Contains(arg, "=") || output != "":
+					fmt.Println(docsUsage)
+					return newCommandError(ExitUsage, fmt.Errorf("unknown arg %s", arg))
+				default:
+					output = arg
+				}
+			}
+			if format == "" || output == "" {
+				fmt.Println(docsUsage)
+				if len(r.Args) == 0 {
+					return nil
+				}
+				return newCommandError(ExitUsage, errors.New("please provide the format and output of the documentation"))
+			}
+
+			cache := r.Config.GetCache()
+			if source != "" {
+				var err error
+				if cache, err = readAPICache(r, source); err != nil {
+					return newCommandError(ExitUsage, err)
+				}
+			}
+			warnUnknownAPIs(cache, apis)
+			groups := groupAPIsByNoun(cache, apis)
+			if len(groups) == 0 {
+				return newCommandError(ExitUsage, errors.New("no APIs found to document"))
+			}
+
+			var count int
+			var err error
+			switch format {
+			case "man":
+				count, err = writeManDocs(r, groups, output)
+			case "markdown":
+				count, err = writeMarkdownDocs(r, groups, output)
+			case "html":
+				if output == "-" {
+					_, err = writeHTMLDocs(r, groups, os.Stdout)
+					return err
+				}
+				err = writeDocFile(output, func(w io.Writer) error {
+					var renderErr error
+					count, renderErr = writeHTMLDocs(r, groups, w)
+					return renderErr
+				})
+			default:
+				return newCommandError(ExitUsage, fmt.Errorf("invalid format %s, use man, markdown or html", format))
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Documented %d APIs in %s\n", count, output)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,202 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/apache/cloudstack-cloudmonkey/pkg/client"
+)
+
+// Process exit codes used by cmk in CLI mode
+const (
+	ExitOK             = 0
+	ExitError          = 1
+	ExitUsage          = 2
+	ExitMissingParams  = 3
+	ExitAuth           = 4
+	ExitNetwork        = 5
+	ExitAPIError       = 6
+	ExitAsyncJobFailed = 7
+	ExitTimeout        = 8
+	ExitErrorState     = 9
+	ExitInterrupted    = 130
+)
+
+var exitCodeNames = map[int]string{
+	ExitError:          "error",
+	ExitUsage:          "usage",
+	ExitMissingParams:  "missing_params",
+	ExitAuth:           "auth",
+	ExitNetwork:        "network",
+	ExitAPIError:       "api_error",
+	ExitAsyncJobFailed: "async_job_failed",
+	ExitTimeout:        "timeout",
+	ExitErrorState:     "error_state",
+	ExitInterrupted:    "interrupted",
+}
+
+// CommandError is an error with the process exit code it should result in
+type CommandError struct {
+	Code    int
+	Err     error
+	Details map[string]interface{}
+}
+
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+func newCommandError(code int, err error) *CommandError {
+	return &CommandError{Code: code, Err: err}
+}
+
+// UploadError is returned when uploading a file to the URL returned by a
+// getUploadParamsFor* API fails
+type UploadError struct {
+	File       string
+	StatusCode int
+	Err        error
+}
+
+func (e *UploadError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("failed to upload %s (HTTP %d): %v", e.File, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("failed to upload %s: %v", e.File, e.Err)
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// apiErrorExitCode maps the HTTP error code of an API error response
+func apiErrorExitCode(errorCode int) int {
+	switch errorCode {
+	case 401:
+		return ExitAuth
+	case 431:
+		return ExitMissingParams
+	case 432:
+		return ExitUsage
+	}
+	return ExitAPIError
+}
+
+// ExitCode returns the process exit code for an error returned by a command
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var cmdErr *CommandError
+	var apiErr *client.APIError
+	var authErr *client.AuthError
+	var jobErr *client.AsyncJobError
+	var uploadErr *UploadError
+	var netErr net.Error
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &cmdErr):
+		return cmdErr.Code
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	case errors.Is(err, client.ErrJobTimeout):
+		return ExitTimeout
+	case errors.As(err, &jobErr):
+		return ExitAsyncJobFailed
+	case errors.As(err, &apiErr):
+		return apiErrorExitCode(apiErr.ErrorCode)
+	case errors.As(err, &authErr), errors.Is(err, client.ErrNoCredentials):
+		return ExitAuth
+	case errors.As(err, &uploadErr):
+		return ExitAPIError
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ExitTimeout
+	case errors.As(err, &urlErr):
+		return ExitNetwork
+	}
+	return ExitError
+}
+
+// errorDetails returns the fields of the typed errors in an error chain
+func errorDetails(err error) map[string]interface{} {
+	details := make(map[string]interface{})
+	var cmdErr *CommandError
+	var apiErr *client.APIError
+	var authErr *client.AuthError
+	var jobErr *client.AsyncJobError
+	var uploadErr *UploadError
+	if errors.As(err, &cmdErr) {
+		for key, value := range cmdErr.Details {
+			details[key] = value
+		}
+	}
+	if errors.As(err, &jobErr) {
+		details["jobid"] = jobErr.JobID
+	}
+	if errors.As(err, &apiErr) {
+		details["api"] = apiErr.API
+		details["statuscode"] = apiErr.StatusCode
+		details["errorcode"] = apiErr.ErrorCode
+		details["cserrorcode"] = apiErr.CSErrorCode
+		details["errortext"] = apiErr.ErrorText
+	}
+	if errors.As(err, &authErr) && authErr.StatusCode > 0 {
+		details["statuscode"] = authErr.StatusCode
+	}
+	if errors.As(err, &uploadErr) {
+		details["file"] = uploadErr.File
+		if uploadErr.StatusCode > 0 {
+			details["statuscode"] = uploadErr.StatusCode
+		}
+	}
+	return details
+}
+
+// PrintError prints an error returned by a command, as JSON on stderr when
+// the json output format is used
+func PrintError(outputFormat string, err error) {
+	if outputFormat != config.JSON {
+		fmt.Println("🙈 Error:", err)
+		return
+	}
+	code := ExitCode(err)
+	output := map[string]interface{}{
+		"exitcode": code,
+		"type":     exitCodeNames[code],
+		"message":  err.Error(),
+	}
+	for key, value := range errorDetails(err) {
+		output[key] = value
+	}
+	enc := json.NewEncoder(os.Stderr)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]interface{}{"error": output})
+}
@@ -18,6 +18,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 )
 
@@ -26,6 +27,9 @@ func init() {
 		Name: "exit",
 		Help: "Exits",
 		Handle: func(r *Request) error {
+			if err := r.Config.FlushTrace(); err != nil {
+				fmt.Println("Failed to write the trace file:", err)
+			}
 			os.Exit(0)
 			return nil
 		},
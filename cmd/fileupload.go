@@ -18,6 +18,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -62,46 +63,44 @@ func ValidateAndGetFileList(filePaths string) ([]string, error) {
 }
 
 // PromptAndUploadFilesIfNeeded prompts the user to provide file paths for upload and the API is getUploadParamsFor*
-func PromptAndUploadFilesIfNeeded(r *Request, api string, response map[string]interface{}) {
+func PromptAndUploadFilesIfNeeded(r *Request, api string, response map[string]interface{}) error {
 	if !r.Config.HasShell {
-		return
+		return nil
 	}
 	apiName := strings.ToLower(api)
 	if !config.IsFileUploadAPI(apiName) {
-		return
+		return nil
 	}
 	fmt.Print("Enter path of the file(s) to upload (comma-separated), leave empty to skip: ")
 	var filePaths string
 	fmt.Scanln(&filePaths)
 	if filePaths == "" {
-		return
+		return nil
 	}
 	validFiles, err := ValidateAndGetFileList(filePaths)
 	if err != nil {
 		fmt.Println(err)
-		return
+		return nil
 	}
 	if len(validFiles) == 0 {
 		fmt.Println("No valid files to upload.")
-		return
+		return nil
 	}
-	UploadFiles(r, api, response, validFiles)
+	return UploadFiles(r, api, response, validFiles)
 }
 
 // UploadFiles uploads files to a remote server using parameters from the API response.
-// Shows progress for each file and reports any failures.
-func UploadFiles(r *Request, api string, response map[string]interface{}, validFiles []string) {
+// Shows progress for each file and returns an error if any upload failed.
+func UploadFiles(r *Request, api string, response map[string]interface{}, validFiles []string) error {
 	paramsRaw, ok := response["getuploadparams"]
 	if !ok || reflect.TypeOf(paramsRaw).Kind() != reflect.Map {
-		fmt.Println("Invalid response format for getuploadparams.")
-		return
+		return errors.New("invalid response format for getuploadparams")
 	}
 	params := paramsRaw.(map[string]interface{})
 	requiredKeys := []string{"postURL", "metadata", "signature", "expires"}
 	for _, key := range requiredKeys {
 		if _, ok := params[key]; !ok {
-			fmt.Printf("Missing required key '%s' in getuploadparams response.\n", key)
-			return
+			return fmt.Errorf("missing required key '%s' in getuploadparams response", key)
 		}
 	}
 	postURL, _ := params["postURL"].(string)
@@ -110,24 +109,34 @@ func UploadFiles(r *Request, api string, response map[string]interface{}, validF
 	metadata, _ := params["metadata"].(string)
 
 	fmt.Println("Uploading files for", api, ":", validFiles)
+	client := &http.Client{
+		Timeout: 24 * time.Hour,
+		Transport: r.Config.RateLimitTransport(&http.Transport{
+			ExpectContinueTimeout: 0,
+		}),
+	}
 	spinner := r.Config.StartSpinner(uploadingMessage)
 	errored := 0
+	var uploadErr error
 	for i, filePath := range validFiles {
-		spinner.Suffix = fmt.Sprintf(" uploading %d/%d %s...", i+1, len(validFiles), filepath.Base(filePath))
-		if err := uploadFile(i, len(validFiles), postURL, filePath, signature, expires, metadata, spinner); err != nil {
-			spinner.Stop()
+		r.Config.UpdateSpinner(spinner, fmt.Sprintf("uploading %d/%d %s...", i+1, len(validFiles), filepath.Base(filePath)))
+		if err := uploadFile(client, i, len(validFiles), postURL, filePath, signature, expires, metadata, spinner); err != nil {
+			if !errors.As(err, new(*UploadError)) {
+				err = &UploadError{File: filePath, Err: err}
+			}
+			r.Config.StopSpinner(spinner)
 			fmt.Println("Error uploading", filePath, ":", err)
 			errored++
-			spinner.Suffix = fmt.Sprintf(" %s", uploadingMessage)
-			spinner.Start()
+			uploadErr = err
+			spinner = r.Config.StartSpinner(uploadingMessage)
 		}
 	}
 	r.Config.StopSpinner(spinner)
 	if errored > 0 {
-		fmt.Printf("🙈 %d out of %d files failed to upload.\n", errored, len(validFiles))
-	} else {
-		fmt.Println("All files uploaded successfully.")
+		return fmt.Errorf("%d out of %d files failed to upload: %w", errored, len(validFiles), uploadErr)
 	}
+	fmt.Println("All files uploaded successfully.")
+	return nil
 }
 
 // progressReader streams file data and updates progress as bytes are read.
@@ -170,7 +179,7 @@ func barArrow(pct int) string {
 }
 
 // uploadFile streams a large file to the server with progress updates.
-func uploadFile(index, count int, postURL, filePath, signature, expires, metadata string, spn *spinner.Spinner) error {
+func uploadFile(client *http.Client, index, count int, postURL, filePath, signature, expires, metadata string, spn *spinner.Spinner) error {
 	fileName := filepath.Base(filePath)
 	in, err := os.Open(filePath)
 	if err != nil {
@@ -220,6 +229,9 @@ func uploadFile(index, count int, postURL, filePath, signature, expires, metadat
 		f:     tmp,
 		total: size,
 		update: func(pct int) {
+			if spn == nil {
+				return
+			}
 			spn.Suffix = fmt.Sprintf(" [%d/%d] %s\t%s %d%%", index+1, count, fileName, barArrow(pct), pct)
 		},
 	}
@@ -231,12 +243,6 @@ func uploadFile(index, count int, postURL, filePath, signature, expires, metadat
 		}
 		return f, nil
 	}
-	client := &http.Client{
-		Timeout: 24 * time.Hour,
-		Transport: &http.Transport{
-			ExpectContinueTimeout: 0,
-		},
-	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -244,9 +250,13 @@ func uploadFile(index, count int, postURL, filePath, signature, expires, metadat
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("[%d/%d] %s\tupload failed: %s", index+1, count, fileName, string(b))
+		return &UploadError{File: filePath, StatusCode: resp.StatusCode, Err: fmt.Errorf("[%d/%d] %s\tupload failed: %s", index+1, count, fileName, string(b))}
 	}
 
+	if spn == nil {
+		fmt.Printf("[%d/%d] %s\t%s ✅\n", index+1, count, fileName, barArrow(100))
+		return nil
+	}
 	spn.Stop()
 	fmt.Printf("[%d/%d] %s\t%s ✅\n", index+1, count, fileName, barArrow(100))
 	spn.Suffix = fmt.Sprintf(" %s", uploadingMessage)
@@ -0,0 +1,57 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/mock"
+)
+
+func TestUploadFiles(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+	r := newTestRequest(t, server)
+
+	filePath := filepath.Join(t.TempDir(), "template.qcow2")
+	if err := os.WriteFile(filePath, make([]byte, 4096), 0600); err != nil {
+		t.Fatal(err)
+	}
+	api := "getUploadParamsForTemplate"
+	response, err := NewAPIRequest(r, api, []string{"name=t", "format=QCOW2", "hypervisor=KVM", "ostypeid=o", "zoneid=z"}, false)
+	if err != nil {
+		t.Fatalf("failed to get upload params: %v", err)
+	}
+	if err := UploadFiles(r, api, response, []string{filePath}); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	uploads := server.Uploads()
+	if len(uploads) != 1 || uploads[0].FileName != "template.qcow2" || uploads[0].Size != 4096 {
+		t.Errorf("expected template.qcow2 of 4096 bytes to be uploaded, got %v", uploads)
+	}
+
+	response["getuploadparams"].(map[string]interface{})["signature"] = "forged"
+	if err := UploadFiles(r, api, response, []string{filePath}); ExitCode(err) != ExitAPIError {
+		t.Errorf("expected a forged upload signature to be rejected, got %v", err)
+	}
+	if uploads := server.Uploads(); len(uploads) != 1 {
+		t.Errorf("expected the forged upload to be rejected, got %v", uploads)
+	}
+}
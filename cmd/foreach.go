@@ -0,0 +1,310 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/apache/cloudstack-cloudmonkey/pkg/client"
+	"github.com/google/shlex"
+)
+
+const (
+	foreachPlaceholder    = "{}"
+	defaultForeachWorkers = 5
+)
+
+const foreachUsage = `Usage: foreach [workers=N] [from=<-|@file|list API>] [key=id] <API> [args...]
+
+Runs an API once for each item read from stdin (-), a file with one item per
+line (@file) or the results of a list API (for example from="list
+virtualmachines state=Running", using the key field of each result). The item
+replaces {} in the API args, or is passed as id=<item> when no arg uses {}.`
+
+type foreachOptions struct {
+	workers int
+	from    string
+	key     string
+}
+
+type foreachResult struct {
+	item   string
+	status string
+	jobID  string
+	err    error
+}
+
+func parseForeachOptions(args []string) (foreachOptions, []string, error) {
+	opts := foreachOptions{workers: defaultForeachWorkers, key: "id"}
+	for len(args) > 0 {
+		switch {
+		case strings.HasPrefix(args[0], "workers="):
+			workers, err := strconv.Atoi(strings.TrimPrefix(args[0], "workers="))
+			if err != nil || workers < 1 {
+				return opts, nil, fmt.Errorf("invalid number of workers: %s", args[0])
+			}
+			opts.workers = workers
+		case strings.HasPrefix(args[0], "from="):
+			opts.from = strings.TrimPrefix(args[0], "from=")
+		case strings.HasPrefix(args[0], "key="):
+			opts.key = strings.TrimPrefix(args[0], "key=")
+		default:
+			return opts, args, nil
+		}
+		args = args[1:]
+	}
+	return opts, args, nil
+}
+
+func readForeachLines(reader io.Reader) ([]string, error) {
+	var items []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			items = append(items, line)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// isTerminal returns true if a file is a terminal rather than a pipe or file
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// readForeachItems returns the items to run an API for
+func readForeachItems(ctx context.Context, r *Request, opts foreachOptions) ([]string, error) {
+	switch {
+	case opts.from == "-" || (opts.from == "" && !isTerminal(os.Stdin)):
+		return readForeachLines(os.Stdin)
+	case opts.from == "":
+		return nil, newCommandError(ExitUsage, errors.New("please provide the items using from=<-|@file|list API>"))
+	case strings.HasPrefix(opts.from, "@"):
+		file, err := os.Open(opts.from[1:])
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return readForeachLines(file)
+	}
+
+	listArgs, err := shlex.Split(opts.from)
+	if err != nil || len(listArgs) == 0 {
+		return nil, newCommandError(ExitUsage, fmt.Errorf("invalid list API: %s", opts.from))
+	}
+	apiName, apiArgs := findAPI(r, listArgs)
+	api := r.Config.GetCache()[apiName]
+	if api == nil {
+		return nil, newCommandError(ExitUsage, fmt.Errorf("unknown list API: %s", opts.from))
+	}
+	params, err := buildParams(api, apiArgs)
+	if err != nil {
+		return nil, err
+	}
+	_, results, err := NewClient(r).ListAll(ctx, api.Name, params, 0)
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	for _, result := range results {
+		if resource, ok := result.(map[string]interface{}); ok && resource[opts.key] != nil {
+			items = append(items, fmt.Sprint(resource[opts.key]))
+		}
+	}
+	return items, nil
+}
+
+func foreachArgs(args []string, item string) []string {
+	itemArgs := make([]string, 0, len(args)+1)
+	replaced := false
+	for _, arg := range args {
+		if strings.Contains(arg, foreachPlaceholder) {
+			arg = strings.ReplaceAll(arg, foreachPlaceholder, item)
+			replaced = true
+		}
+		itemArgs = append(itemArgs, arg)
+	}
+	if !replaced {
+		itemArgs = append(itemArgs, "id="+item)
+	}
+	return itemArgs
+}
+
+// runWorkers calls fn for the indexes 0 to count-1 using a pool of workers,
+// dispatching at most rate calls per second when rate is positive. No more
+// calls are dispatched once the context is done.
+func runWorkers(ctx context.Context, count int, workers int, rate float64, fn func(idx int)) {
+	var throttle <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers && worker < count; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				fn(idx)
+			}
+		}()
+	}
+	for idx := 0; idx < count && ctx.Err() == nil; idx++ {
+		if throttle != nil && idx > 0 {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				continue
+			}
+		}
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// runForeach runs an API for all items using a pool of workers, the async
+// jobs of the calls are polled concurrently
+func runForeach(ctx context.Context, r *Request, api *config.API, args []string, items []string, workers int) []foreachResult {
+	results := make([]foreachResult, len(items))
+	for idx, item := range items {
+		results[idx] = foreachResult{item: item, status: "skipped"}
+	}
+
+	var done int32
+	waiter := r.Config.StartSpinner(fmt.Sprintf("running %s for %d items...", api.Name, len(items)))
+	worker := r.WithProgress(func(message string) {
+		r.Config.UpdateSpinner(waiter, fmt.Sprintf("running %s, finished %d/%d, %s", api.Name, atomic.LoadInt32(&done), len(items), message))
+	})
+	runWorkers(ctx, len(items), workers, 0, func(idx int) {
+		result := &results[idx]
+		response, err := apiRequest(ctx, worker, api.Name, foreachArgs(args, result.item), api.Async)
+		result.status = "success"
+		if err != nil {
+			result.status = "failed"
+			result.err = err
+		}
+		var jobErr *client.AsyncJobError
+		if jobID, ok := response["jobid"].(string); ok {
+			result.jobID = jobID
+		} else if errors.As(err, &jobErr) {
+			result.jobID = jobErr.JobID
+		}
+		finished := atomic.AddInt32(&done, 1)
+		r.Config.UpdateSpinner(waiter, fmt.Sprintf("running %s, finished %d/%d...", api.Name, finished, len(items)))
+	})
+	r.Config.StopSpinner(waiter)
+	return results
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "foreach",
+		Help:  "Runs an API for each item from stdin, a file or a list API",
+		Usage: foreachUsage,
+		Handle: func(r *Request) error {
+			opts, args, err := parseForeachOptions(r.Args)
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+			if len(args) == 0 {
+				fmt.Println(foreachUsage)
+				return nil
+			}
+			apiName, apiArgs := findAPI(r, args)
+			api := r.Config.GetCache()[apiName]
+			if api == nil {
+				return newCommandError(ExitUsage, errors.New("unknown command or API requested"))
+			}
+
+			if apiArgs, err = expandParamsArg(r, api, apiArgs); err != nil {
+				return err
+			}
+			if err := checkArgs(r, api, knownArgs(foreachArgs(apiArgs, foreachPlaceholder), foreachPlaceholder)); err != nil {
+				return err
+			}
+
+			ctx := requestContext(r)
+			items, err := readForeachItems(ctx, r, opts)
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				fmt.Println("No items to run", api.Name, "for")
+				return nil
+			}
+
+			// log in once, instead of from every worker
+			profile := r.Config.ActiveProfile
+			if profile.APIKey == "" || profile.SecretKey == "" {
+				if _, err := NewClient(r).Login(ctx); err != nil {
+					return err
+				}
+			}
+
+			results := runForeach(ctx, r, api, apiArgs, items, opts.workers)
+
+			var firstErr error
+			failed := 0
+			rows := make([]interface{}, 0, len(results))
+			for _, result := range results {
+				row := map[string]interface{}{
+					"item":   result.item,
+					"status": result.status,
+					"jobid":  result.jobID,
+					"error":  "",
+				}
+				if result.err != nil {
+					row["error"] = result.err.Error()
+					failed++
+					if firstErr == nil {
+						firstErr = result.err
+					}
+				}
+				rows = append(rows, row)
+			}
+			printResult(r.Config.Core.Output, map[string]interface{}{"count": len(rows), "results": rows}, nil, nil)
+
+			if ctx.Err() != nil {
+				if r.Config.HasShell {
+					return nil
+				}
+				return ctx.Err()
+			}
+			if failed > 0 {
+				return newCommandError(ExitCode(firstErr), fmt.Errorf("%d out of %d %s calls failed", failed, len(results), api.Name))
+			}
+			return nil
+		},
+	})
+}
@@ -20,59 +20,92 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/apache/cloudstack-cloudmonkey/config"
 )
 
+const helpUsage = `Usage: help [<command>|<API>|-k <terms>...] [format=text|markdown|man]
+
+Shows the usage of a command, or the documentation of an API. Use help -k
+<terms>, or apropos <terms>, to search the APIs. The documentation of an API is
+rendered as markdown or a man page with format=markdown or format=man. Usage
+examples of an API are read from profiles/examples/<api>.txt in the config
+directory when present.`
+
 var helpCommand *Command
 
 func init() {
 	helpCommand = &Command{
-		Name: "help",
-		Help: "Help",
+		Name:  "help",
+		Help:  "Help",
+		Usage: helpUsage,
 		Handle: func(r *Request) error {
 			if len(r.Args) < 1 || r.Args[0] == "-h" {
 				PrintUsage()
 				return nil
 			}
 
-			api := r.Config.GetCache()[strings.ToLower(r.Args[0])]
-			if api == nil {
-				return errors.New("unknown command or API requested")
+			if r.Args[0] == "-k" {
+				r.Args = r.Args[1:]
+				return aproposHandler(r)
 			}
 
-			fmt.Printf("\033[34m%s\033[0m: %s\n", api.Name, api.Description)
-			if api.Async {
-				fmt.Println("This API is \033[35masynchronous\033[0m.")
-			}
-			if len(api.RequiredArgs) > 0 {
-				fmt.Printf("Required params: ")
-				for _, requiredArg := range api.RequiredArgs {
-					fmt.Printf("%s, ", strings.Replace(requiredArg, "=", "", -1))
+			format := "text"
+			var terms []string
+			for _, arg := range r.Args {
+				if strings.HasPrefix(arg, "format=") {
+					format = strings.TrimPrefix(arg, "format=")
+				} else {
+					terms = append(terms, arg)
 				}
-				fmt.Println()
 			}
-			if len(api.Args) > 0 {
-				fmt.Printf("%-24s %-8s %s\n", "API Params", "Type", "Description")
-				fmt.Printf("%-24s %-8s %s\n", "==========", "====", "===========")
+			if !config.CheckIfValuePresent(docFormats, format) {
+				return newCommandError(ExitUsage, fmt.Errorf("invalid format %s, use one of %s", format, strings.Join(docFormats, ", ")))
+			}
+			if len(terms) == 0 {
+				PrintUsage()
+				return nil
+			}
+
+			command := FindCommand(terms[0])
+			if terms[0] == apiCommand.Name {
+				command = apiCommand
 			}
-			for _, arg := range api.Args {
-				if arg.Type == config.FAKE {
-					continue
+			if command != nil {
+				if command.Usage != "" {
+					fmt.Println(command.Usage)
+				} else {
+					fmt.Printf("%s: %s\n", command.Name, command.Help)
 				}
-				fmt.Printf("\033[36m%-24s\033[0m \033[32m%-8s\033[0m ", strings.Replace(arg.Name, "=", "", -1), arg.Type)
-				info := []rune(arg.Description)
-				for i, r := range info {
-					fmt.Printf("%s", string(r))
-					if i > 0 && i%40 == 0 {
-						fmt.Println()
-						for i := 0; i < 34; i++ {
-							fmt.Printf(" ")
-						}
-					}
+				return nil
+			}
+
+			apiName, _ := findAPI(r, terms)
+			api := r.Config.GetCache()[apiName]
+			if api == nil {
+				matches := searchAPIs(r.Config.GetCache(), terms)
+				if len(matches) == 0 {
+					return errors.New("unknown command or API requested")
 				}
-				fmt.Println()
+				fmt.Printf("No API named %s, matching APIs:\n", strings.Join(terms, " "))
+				if len(matches) > defaultAproposLimit {
+					matches = matches[:defaultAproposLimit]
+				}
+				printSearchMatches(matches, "text")
+				return nil
+			}
+
+			examples := r.Config.APIExamples(api.Name)
+			api = withoutFakeArgs(api)
+			switch format {
+			case "text":
+				writeAPIText(os.Stdout, api, examples, terminalWidth())
+			case "markdown":
+				writeAPIMarkdown(os.Stdout, api, examples, 1)
+			case "man":
+				writeAPIMan(os.Stdout, api, examples)
 			}
 			return nil
 		},
@@ -0,0 +1,221 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/google/shlex"
+)
+
+const lintUsage = `Usage: lint [format=text|json] <script>...
+
+Checks cmk scripts, with one command per line, against the API cache of the
+active profile. Unknown APIs and parameters, missing required parameters and
+parameter values not matching their type are reported as errors, deprecated
+APIs and parameters as warnings. The APIs run by foreach, batch and watch are
+checked as well. Empty lines and lines starting with # are skipped.`
+
+// lintIssue is a problem found in a line of a script
+type lintIssue struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func isDeprecated(description string) bool {
+	return strings.Contains(strings.ToLower(description), "deprecated")
+}
+
+// lintAPI returns the problems of an API invocation. Values containing the
+// placeholder are only known when the API runs and are not validated, missing
+// parameters are only reported when checkMissing is set.
+func lintAPI(r *Request, args []string, checkMissing bool, placeholder string) (errs []string, warnings []string) {
+	if len(args) == 0 {
+		return []string{"missing API"}, nil
+	}
+	apiName, apiArgs := findAPI(r, args)
+	api := r.Config.GetCache()[apiName]
+	if api == nil {
+		return []string{"unknown command or API " + strings.Join(args[:minInt(2, len(args))], " ")}, nil
+	}
+	if isDeprecated(api.Description) {
+		warnings = append(warnings, fmt.Sprintf("API %s is deprecated", api.Name))
+	}
+	for _, arg := range apiArgs {
+		if apiArg := findArg(api, strings.SplitN(arg, "=", 2)[0]); apiArg != nil && isDeprecated(apiArg.Description) {
+			warnings = append(warnings, fmt.Sprintf("parameter %s of %s is deprecated", strings.TrimSuffix(apiArg.Name, "="), api.Name))
+		}
+	}
+	hasParams := false
+	for _, arg := range apiArgs {
+		hasParams = hasParams || (strings.HasPrefix(arg, paramsArg) && !api.HasArg(paramsArg))
+	}
+	if missing := missingArgs(api, apiArgs); len(missing) > 0 && checkMissing && !hasParams {
+		errs = append(errs, fmt.Sprintf("missing required parameters of %s: %s", api.Name, strings.Join(missing, ", ")))
+	}
+	errs = append(errs, validateArgs(api, knownArgs(apiArgs, placeholder))...)
+	return errs, warnings
+}
+
+// lintCommand returns the problems of a command in a script, including the API
+// invocations run by the foreach, batch and watch commands
+func lintCommand(r *Request, args []string) (errs []string, warnings []string) {
+	for idx, arg := range args {
+		if arg == "|" {
+			args = args[:idx]
+			break
+		}
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	switch args[0] {
+	case "foreach":
+		opts, apiArgs, err := parseForeachOptions(args[1:])
+		if err != nil {
+			return []string{err.Error()}, nil
+		}
+		if opts.from != "" && opts.from != "-" && !strings.HasPrefix(opts.from, "@") {
+			listArgs, err := shlex.Split(opts.from)
+			if err != nil {
+				return []string{fmt.Sprintf("invalid list API %s: %v", opts.from, err)}, nil
+			}
+			errs, warnings = lintAPI(r, listArgs, true, "")
+		}
+		if len(apiArgs) > 0 {
+			apiArgs = foreachArgs(apiArgs, foreachPlaceholder)
+		}
+		apiErrs, apiWarnings := lintAPI(r, apiArgs, true, foreachPlaceholder)
+		return append(errs, apiErrs...), append(warnings, apiWarnings...)
+	case "batch":
+		_, batchArgs, err := parseBatchOptions(args[1:])
+		if err != nil {
+			return []string{err.Error()}, nil
+		}
+		if len(batchArgs) == 0 {
+			return []string{"missing batch file"}, nil
+		}
+		// the rows of the batch file provide further parameters
+		return lintAPI(r, batchArgs[1:], false, "")
+	case "watch":
+		_, _, apiArgs, err := parseWatchOptions(args[1:])
+		if err != nil {
+			return []string{err.Error()}, nil
+		}
+		return lintAPI(r, apiArgs, true, "")
+	}
+	if FindCommand(args[0]) != nil && !(args[0] == "sync" && len(args) > 1 && args[1] != syncCheckArg) {
+		return nil, nil
+	}
+	return lintAPI(r, args, true, "")
+}
+
+// lintScript returns the problems of the commands in a script file
+func lintScript(r *Request, fileName string) ([]lintIssue, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var issues []lintIssue
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		args, err := shlex.Split(text)
+		if err != nil {
+			issues = append(issues, lintIssue{fileName, line, "error", err.Error()})
+			continue
+		}
+		errs, warnings := lintCommand(r, args)
+		for _, message := range errs {
+			issues = append(issues, lintIssue{fileName, line, "error", message})
+		}
+		for _, message := range warnings {
+			issues = append(issues, lintIssue{fileName, line, "warning", message})
+		}
+	}
+	return issues, scanner.Err()
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "lint",
+		Help:  "Checks cmk scripts against the API cache",
+		Usage: lintUsage,
+		Handle: func(r *Request) error {
+			format := "text"
+			var files []string
+			for _, arg := range r.Args {
+				if strings.HasPrefix(arg, "format=") {
+					format = strings.TrimPrefix(arg, "format=")
+					if format != "text" && format != "json" {
+						return newCommandError(ExitUsage, fmt.Errorf("invalid format %s, use text or json", format))
+					}
+					continue
+				}
+				files = append(files, arg)
+			}
+			if len(files) == 0 {
+				fmt.Println(lintUsage)
+				return nil
+			}
+
+			issues := []lintIssue{}
+			for _, fileName := range files {
+				fileIssues, err := lintScript(r, fileName)
+				if err != nil {
+					return newCommandError(ExitUsage, err)
+				}
+				issues = append(issues, fileIssues...)
+			}
+
+			errorCount := 0
+			for _, issue := range issues {
+				if issue.Severity == "error" {
+					errorCount++
+				}
+			}
+			if format == "json" {
+				output, _ := json.MarshalIndent(issues, "", "  ")
+				fmt.Println(string(output))
+			} else {
+				for _, issue := range issues {
+					fmt.Printf("%s:%d: %s: %s\n", issue.File, issue.Line, issue.Severity, issue.Message)
+				}
+				fmt.Printf("%d errors, %d warnings\n", errorCount, len(issues)-errorCount)
+			}
+			config.Debug("Linted ", len(files), " scripts")
+			if errorCount > 0 {
+				return newCommandError(ExitError, errors.New("lint found errors"))
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,101 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/google/shlex"
+)
+
+const lintTestCache = `{"api": [
+	{"name": "listZones", "params": [
+		{"name": "id", "type": "uuid"},
+		{"name": "available", "type": "boolean"}
+	]},
+	{"name": "listVirtualMachines", "params": [
+		{"name": "id", "type": "uuid"},
+		{"name": "state", "type": "string"}
+	]},
+	{"name": "deployVirtualMachine", "isasync": true, "params": [
+		{"name": "zoneid", "type": "uuid", "required": true},
+		{"name": "templateid", "type": "uuid", "required": true},
+		{"name": "hostid", "type": "uuid", "description": "Deprecated, use the host tags of the service offering"}
+	]},
+	{"name": "startVirtualMachine", "isasync": true, "params": [
+		{"name": "id", "type": "uuid", "required": true}
+	]},
+	{"name": "listHosts", "description": "Deprecated, lists hosts"}
+]}`
+
+// newLintRequest returns a request whose API cache holds the lint test APIs
+func newLintRequest(t *testing.T) *Request {
+	t.Helper()
+	configFile := ""
+	cfg := config.NewConfig(&configFile)
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(lintTestCache), &response); err != nil {
+		t.Fatalf("invalid test API cache: %v", err)
+	}
+	if _, err := cfg.UpdateCache(response); err != nil {
+		t.Fatalf("failed to update the API cache: %v", err)
+	}
+	return NewRequest(nil, cfg, nil, false)
+}
+
+func TestLintCommand(t *testing.T) {
+	r := newLintRequest(t)
+	const zoneID = "3c7a5b52-1cf5-4fbd-8a57-6d0b3d7e1e4f"
+	tests := []struct {
+		command  string
+		errs     []string
+		warnings []string
+	}{
+		{"list zones available=true", nil, nil},
+		{"list zones available=maybe", []string{"value maybe of available is not a boolean, use true or false"}, nil},
+		{"list zones availabel=true", []string{"unknown parameter availabel for listZones, did you mean available?"}, nil},
+		{"deploy virtualmachine zoneid=" + zoneID, []string{"missing required parameters of deployVirtualMachine: templateid"}, nil},
+		{"deploy virtualmachine zoneid=" + zoneID + " templateid=" + zoneID + " hostid=" + zoneID, nil, []string{"parameter hostid of deployVirtualMachine is deprecated"}},
+		{"list hosts", nil, []string{"API listHosts is deprecated"}},
+		{"listNothing", []string{"unknown command or API listNothing"}, nil},
+		{"list zones | grep zone", nil, nil},
+		{"set output json", nil, nil},
+		{`foreach from="list virtualmachines state=Running" start virtualmachine`, nil, nil},
+		{"foreach from=- start virtualmachine id={}", nil, nil},
+		{`foreach from="list virtualmachinez" start virtualmachine`, []string{"unknown command or API list virtualmachinez"}, nil},
+		{"foreach from=@ids.txt list zones available={}", nil, nil},
+		{"foreach from=@ids.txt start virtualmachine id=vm-1", []string{"value vm-1 of id is not a valid id"}, nil},
+		{"batch vms.csv deploy virtualmachine", nil, nil},
+		{"batch vms.csv deploy virtualmachine zoneid=zone-1", []string{"value zone-1 of zoneid is not a valid id"}, nil},
+		{"batch workers=2", []string{"missing batch file"}, nil},
+		{"watch interval=5 list zones available=maybe", []string{"value maybe of available is not a boolean, use true or false"}, nil},
+	}
+	for _, test := range tests {
+		args, err := shlex.Split(test.command)
+		if err != nil {
+			t.Fatalf("invalid test command %s: %v", test.command, err)
+		}
+		errs, warnings := lintCommand(r, args)
+		if strings.Join(errs, "\n") != strings.Join(test.errs, "\n") || strings.Join(warnings, "\n") != strings.Join(test.warnings, "\n") {
+			t.Errorf("lint of %s: expected errors %q and warnings %q, got %q and %q", test.command, test.errs, test.warnings, errs, warnings)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/apache/cloudstack-cloudmonkey/mock"
+)
+
+func TestMain(m *testing.M) {
+	// the config and API cache are kept in a throwaway home directory
+	home, err := os.MkdirTemp("", "cmk-test-home-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// newTestRequest returns a request for the mock server using API keys
+func newTestRequest(t *testing.T, server *mock.Server) *Request {
+	t.Helper()
+	configFile := ""
+	cfg := config.NewConfig(&configFile)
+	cfg.UpdateConfig("url", server.APIURL(), false)
+	cfg.UpdateConfig("apikey", server.APIKey, false)
+	cfg.UpdateConfig("secretkey", server.SecretKey, false)
+	cfg.UpdateConfig("pollinterval", "1", false)
+	config.LoadCache(cfg)
+	return NewRequest(nil, cfg, nil, false)
+}
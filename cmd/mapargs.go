@@ -0,0 +1,158 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+// splitTopLevel splits a value on the commas outside braces and brackets
+func splitTopLevel(value string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for idx, chr := range value {
+		switch chr {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced braces")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, value[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced braces")
+	}
+	return append(parts, value[start:]), nil
+}
+
+// parseMapEntries parses comma separated key:value or key=value pairs
+func parseMapEntries(value string) ([][2]string, error) {
+	parts, err := splitTopLevel(value)
+	if err != nil {
+		return nil, err
+	}
+	var entries [][2]string
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		idx := strings.IndexAny(part, ":=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid map entry %s, expected key:value", part)
+		}
+		entries = append(entries, [2]string{strings.TrimSpace(part[:idx]), strings.TrimSpace(part[idx+1:])})
+	}
+	return entries, nil
+}
+
+// isMapSyntax returns true if the value of a map arg uses the {...},
+// [{...},...] or k1=v1,k2=v2 map syntax rather than being passed as is
+func isMapSyntax(value string) bool {
+	return (strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}")) ||
+		(strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]")) ||
+		strings.Contains(value, "=")
+}
+
+// expandMapArg expands the value of a map arg into CloudStack's indexed form:
+// {k1:v1,k2:v2} sets the keys of a single entry, [{...},{...}] sets the keys
+// of several entries, and k1=v1,k2=v2 sets key and value pairs as used by tags
+func expandMapArg(name string, value string) ([][2]string, error) {
+	var params [][2]string
+	switch {
+	case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+		items, err := splitTopLevel(value[1 : len(value)-1])
+		if err != nil {
+			return nil, err
+		}
+		idx := 0
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			if len(item) == 0 {
+				continue
+			}
+			if !strings.HasPrefix(item, "{") || !strings.HasSuffix(item, "}") {
+				return nil, fmt.Errorf("invalid map list item %s, expected {key:value,...}", item)
+			}
+			entries, err := parseMapEntries(item[1 : len(item)-1])
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				params = append(params, [2]string{fmt.Sprintf("%s[%d].%s", name, idx, entry[0]), entry[1]})
+			}
+			idx++
+		}
+	case strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}"):
+		entries, err := parseMapEntries(value[1 : len(value)-1])
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			params = append(params, [2]string{fmt.Sprintf("%s[0].%s", name, entry[0]), entry[1]})
+		}
+	default:
+		for idx, part := range strings.Split(value, ",") {
+			pair := strings.SplitN(part, "=", 2)
+			if len(pair) != 2 || len(strings.TrimSpace(pair[0])) == 0 {
+				return nil, fmt.Errorf("invalid map entry %s, expected key=value", part)
+			}
+			params = append(params, [2]string{fmt.Sprintf("%s[%d].key", name, idx), strings.TrimSpace(pair[0])})
+			params = append(params, [2]string{fmt.Sprintf("%s[%d].value", name, idx), strings.TrimSpace(pair[1])})
+		}
+	}
+	return params, nil
+}
+
+// expandArg returns the params sent for an arg, expanding the map syntax of map
+// args and the [a,b] syntax of list args
+func expandArg(api *config.API, key string, value string) ([][2]string, error) {
+	if api == nil || strings.Contains(key, "[") {
+		return [][2]string{{key, value}}, nil
+	}
+	arg := findArg(api, key)
+	if arg == nil {
+		return [][2]string{{key, value}}, nil
+	}
+	switch {
+	case arg.Type == "map" && isMapSyntax(value):
+		params, err := expandMapArg(key, value)
+		if err != nil {
+			return nil, newCommandError(ExitUsage, fmt.Errorf("invalid map value of %s: %v", key, err))
+		}
+		return params, nil
+	case arg.Type == "list" && strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+		var items []string
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+		return [][2]string{{key, strings.Join(items, ",")}}, nil
+	}
+	return [][2]string{{key, value}}, nil
+}
@@ -0,0 +1,103 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+func TestParseMapEntries(t *testing.T) {
+	tests := []struct {
+		value   string
+		entries [][2]string
+		valid   bool
+	}{
+		{"cpuSpeed:1000,memory:2048", [][2]string{{"cpuSpeed", "1000"}, {"memory", "2048"}}, true},
+		{"key=env, value = prod", [][2]string{{"key", "env"}, {"value", "prod"}}, true},
+		{"url:http://host:8080", [][2]string{{"url", "http://host:8080"}}, true},
+		{"cpuSpeed:1000,,", [][2]string{{"cpuSpeed", "1000"}}, true},
+		{"cpuSpeed", nil, false},
+		{":1000", nil, false},
+		{"list:{a,b", nil, false},
+	}
+	for _, test := range tests {
+		entries, err := parseMapEntries(test.value)
+		if (err == nil) != test.valid || !reflect.DeepEqual(entries, test.entries) {
+			t.Errorf("parseMapEntries(%q) = %v, %v, expected %v", test.value, entries, err, test.entries)
+		}
+	}
+}
+
+func TestExpandMapArg(t *testing.T) {
+	tests := []struct {
+		value  string
+		params [][2]string
+		valid  bool
+	}{
+		{"{cpuSpeed:1000,memory:2048}", [][2]string{{"details[0].cpuSpeed", "1000"}, {"details[0].memory", "2048"}}, true},
+		{"[{service:Dns,provider:VirtualRouter},{service:Dhcp}]", [][2]string{
+			{"details[0].service", "Dns"}, {"details[0].provider", "VirtualRouter"}, {"details[1].service", "Dhcp"},
+		}, true},
+		{"env=prod,team=core", [][2]string{
+			{"details[0].key", "env"}, {"details[0].value", "prod"}, {"details[1].key", "team"}, {"details[1].value", "core"},
+		}, true},
+		{"[service:Dns]", nil, false},
+		{"env=prod,team", nil, false},
+		{"{cpuSpeed}", nil, false},
+	}
+	for _, test := range tests {
+		params, err := expandMapArg("details", test.value)
+		if (err == nil) != test.valid || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("expandMapArg(%q) = %v, %v, expected %v", test.value, params, err, test.params)
+		}
+	}
+}
+
+func TestExpandArg(t *testing.T) {
+	api := &config.API{
+		Name: "createTags",
+		Args: []*config.APIArg{
+			{Name: "tags=", Type: "map"},
+			{Name: "resourceids=", Type: "list"},
+			{Name: "resourcetype=", Type: "string"},
+		},
+	}
+	tests := []struct {
+		key    string
+		value  string
+		params [][2]string
+	}{
+		{"tags", "env=prod", [][2]string{{"tags[0].key", "env"}, {"tags[0].value", "prod"}}},
+		{"tags", "prod", [][2]string{{"tags", "prod"}}},
+		{"tags[0].key", "env", [][2]string{{"tags[0].key", "env"}}},
+		{"resourceids", "[a, b]", [][2]string{{"resourceids", "a,b"}}},
+		{"resourcetype", "{UserVm}", [][2]string{{"resourcetype", "{UserVm}"}}},
+	}
+	for _, test := range tests {
+		params, err := expandArg(api, test.key, test.value)
+		if err != nil || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("expandArg(%s=%s) = %v, %v, expected %v", test.key, test.value, params, err, test.params)
+		}
+	}
+	if _, err := expandArg(api, "tags", "{env}"); ExitCode(err) != ExitUsage {
+		t.Errorf("expected a usage error for an invalid map value, got %v", err)
+	}
+}
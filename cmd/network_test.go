@@ -0,0 +1,60 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/mock"
+)
+
+func TestNewAPIRequest(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+	r := newTestRequest(t, server)
+
+	response, err := NewAPIRequest(r, "listZones", []string{"name=zone-3"}, false)
+	if err != nil {
+		t.Fatalf("signed request failed: %v", err)
+	}
+	if zones, _ := response["zone"].([]interface{}); len(zones) != 1 {
+		t.Errorf("expected zone-3 to be listed, got %v", response)
+	}
+
+	response, err = NewAPIRequest(r, "deployVirtualMachine", []string{"zoneid=z", "templateid=t", "serviceofferingid=s", "name=vm-1"}, true)
+	if err != nil {
+		t.Fatalf("async request failed: %v", err)
+	}
+	if vm, _ := response["virtualmachine"].(map[string]interface{}); vm == nil || vm["name"] != "vm-1" {
+		t.Errorf("expected the async job result, got %v", response)
+	}
+	if polls := server.CallCount("queryAsyncJobResult"); polls != server.AsyncPolls+1 {
+		t.Errorf("expected %d job polls, got %d", server.AsyncPolls+1, polls)
+	}
+
+	// requests rejected with HTTP 401 are retried by logging in, unless the
+	// credentials were supplied on the command line
+	r.Config.UpdateConfig("secretkey", "wrong-secret-key", false)
+	if _, err := NewAPIRequest(r, "listZones", nil, false); err != nil {
+		t.Errorf("expected the login fallback to succeed, got %v", err)
+	}
+	r.CredentialsSupplied = true
+	if _, err := NewAPIRequest(r, "listZones", nil, false); ExitCode(err) != ExitAuth {
+		t.Errorf("expected an auth failure for a bad signature, got %v", err)
+	}
+}
@@ -0,0 +1,425 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const openAPIUsage = `Usage: openapi [source=<profile|inbuilt|file>] [apis=<api1,api2,...>] [output=<file>]
+
+Exports the APIs of an API cache as an OpenAPI 3 document in JSON. The cache is
+the one of the active profile unless source names a server profile, inbuilt for
+the API cache shipped with cmk, or an API cache file or listApis JSON response.
+Each API is described as a GET operation on /<api> with a required command
+param, clients send it to the API endpoint without the /<api> path as described
+by x-cloudstack-adapter. Map params are arrays of objects sent as
+name[0].key=value. Async APIs respond with a job id, queryAsyncJobResult returns
+their typed <Api>JobResult. The document is printed unless an output file is
+provided.`
+
+// openAPIVersion is the version of the OpenAPI specification exported
+const openAPIVersion = "3.0.3"
+
+// openAPIType returns the schema of a CloudStack param or response field type
+func openAPIType(cloudstackType string) map[string]interface{} {
+	switch strings.ToLower(cloudstackType) {
+	case "uuid":
+		return map[string]interface{}{"type": "string", "format": "uuid"}
+	case "boolean":
+		return map[string]interface{}{"type": "boolean"}
+	case "integer", "short":
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case "long":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case "float", "double":
+		return map[string]interface{}{"type": "number", "format": strings.ToLower(cloudstackType)}
+	case "date", "tzdate":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "list", "set":
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	case "map", "object", "responseobject":
+		return map[string]interface{}{"type": "object", "additionalProperties": true}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// openAPIParameter returns the query parameter of an API arg
+func openAPIParameter(api *config.API, arg *config.APIArg) map[string]interface{} {
+	name := strings.TrimSuffix(arg.Name, "=")
+	schema := openAPIType(arg.Type)
+	if arg.Length > 0 && schema["type"] == "string" && schema["format"] == nil {
+		schema["maxLength"] = arg.Length
+	}
+	parameter := map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"required":    arg.Required,
+		"description": arg.Description,
+		"schema":      schema,
+	}
+	switch strings.ToLower(arg.Type) {
+	case "list":
+		// list args are sent as comma separated values
+		parameter["style"] = "form"
+		parameter["explode"] = false
+	case "map":
+		// map args are sent as name[0].key=value, which no OpenAPI style
+		// serializes, so the encoding is named by an extension
+		properties := make(map[string]interface{})
+		for _, key := range config.MapArgKeys(api, arg) {
+			properties[key] = map[string]interface{}{"type": "string"}
+		}
+		parameter["schema"] = map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"additionalProperties": map[string]interface{}{"type": "string"},
+			},
+		}
+		parameter["style"] = "form"
+		parameter["explode"] = true
+		parameter["x-cloudstack-encoding"] = name + "[<index>].<key>=<value>"
+	}
+	if arg.Since != "" {
+		parameter["x-cloudstack-since"] = arg.Since
+	}
+	return parameter
+}
+
+// openAPIResponseSchema returns the schema of the response fields of an API
+// under a prefix, fields of nested objects are named parent.field
+func openAPIResponseSchema(fields []*config.APIResponse, prefix string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, field := range fields {
+		if !strings.HasPrefix(field.Name, prefix) || strings.Contains(field.Name[len(prefix):], ".") {
+			continue
+		}
+		schema := openAPIType(field.Type)
+		if nested := openAPIResponseSchema(fields, field.Name+"."); len(nested["properties"].(map[string]interface{})) > 0 {
+			if schema["type"] == "array" {
+				schema["items"] = nested
+			} else {
+				schema = nested
+			}
+		}
+		if field.Description != "" {
+			schema["description"] = field.Description
+		}
+		properties[field.Name[len(prefix):]] = schema
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// commandParameter returns the required command param of an API operation
+func commandParameter(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        "command",
+		"in":          "query",
+		"required":    true,
+		"description": "The API to run",
+		"schema":      map[string]interface{}{"type": "string", "enum": []string{name}},
+	}
+}
+
+// asyncJobSchemas returns the schemas of the job of an async API and of the
+// queryAsyncJobResult response for it
+func asyncJobSchemas() map[string]interface{} {
+	uuid := map[string]interface{}{"type": "string", "format": "uuid"}
+	return map[string]interface{}{
+		"AsyncJobResponse": map[string]interface{}{
+			"type":        "object",
+			"description": "The job of an async API, poll queryAsyncJobResult with the jobid for its result",
+			"required":    []string{"jobid"},
+			"properties":  map[string]interface{}{"jobid": uuid, "id": uuid},
+		},
+		"AsyncJobResult": map[string]interface{}{
+			"type":        "object",
+			"description": "The status of an async job as returned by queryAsyncJobResult",
+			"required":    []string{"jobid", "jobstatus"},
+			"properties": map[string]interface{}{
+				"jobid":           uuid,
+				"accountid":       uuid,
+				"userid":          uuid,
+				"cmd":             map[string]interface{}{"type": "string"},
+				"created":         map[string]interface{}{"type": "string", "format": "date-time"},
+				"completed":       map[string]interface{}{"type": "string", "format": "date-time"},
+				"jobinstancetype": map[string]interface{}{"type": "string"},
+				"jobinstanceid":   uuid,
+				"jobprocstatus":   map[string]interface{}{"type": "integer"},
+				"jobresultcode":   map[string]interface{}{"type": "integer"},
+				"jobresulttype":   map[string]interface{}{"type": "string"},
+				"jobstatus": map[string]interface{}{
+					"type":        "integer",
+					"enum":        []int{0, 1, 2},
+					"description": "0 while pending, 1 on success and 2 on failure",
+				},
+				"jobresult": map[string]interface{}{
+					"type":        "object",
+					"description": "The response of the API on success, or the errorcode and errortext on failure",
+					"properties": map[string]interface{}{
+						"errorcode": map[string]interface{}{"type": "integer"},
+						"errortext": map[string]interface{}{"type": "string"},
+					},
+					"additionalProperties": true,
+				},
+			},
+		},
+	}
+}
+
+// jobResultSchema returns the queryAsyncJobResult response of the job of an
+// async API, with the jobresult typed by the response schema of the API
+func jobResultSchema(schemaName string) map[string]interface{} {
+	return map[string]interface{}{
+		"allOf": []interface{}{
+			schemaRef("AsyncJobResult"),
+			map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"jobresult": map[string]interface{}{
+						"type":                 "object",
+						"additionalProperties": schemaRef(schemaName),
+					},
+				},
+			},
+		},
+	}
+}
+
+// openAPIResponse returns the response of an API operation, wrapped in the
+// <api>response object as returned by the management server
+func openAPIResponse(api *config.API, schemaName string) map[string]interface{} {
+	var body map[string]interface{}
+	switch {
+	case strings.EqualFold(api.Name, "queryAsyncJobResult"):
+		body = schemaRef("AsyncJobResult")
+	case api.Async:
+		body = schemaRef("AsyncJobResponse")
+	case api.Verb == "list":
+		body = map[string]interface{}{
+			"type":                 "object",
+			"properties":           map[string]interface{}{"count": map[string]interface{}{"type": "integer"}},
+			"additionalProperties": map[string]interface{}{"type": "array", "items": schemaRef(schemaName)},
+		}
+	default:
+		body = map[string]interface{}{"type": "object", "additionalProperties": schemaRef(schemaName)}
+	}
+	wrapper := strings.ToLower(api.Name) + "response"
+	response := map[string]interface{}{
+		"description": "The response of " + api.Name,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{wrapper: body},
+				},
+			},
+		},
+	}
+	if api.Async {
+		response["links"] = map[string]interface{}{
+			"jobResult": map[string]interface{}{
+				"operationId": "queryAsyncJobResult",
+				"parameters":  map[string]interface{}{"jobid": "$response.body#/" + wrapper + "/jobid"},
+				"description": "The job result, typed by " + jobResultName(api),
+			},
+		}
+	}
+	return response
+}
+
+// jobResultName returns the name of the job result schema of an async API
+func jobResultName(api *config.API) string {
+	return strings.ToUpper(api.Name[:1]) + api.Name[1:] + "JobResult"
+}
+
+// openAPIOperation returns the GET operation of an API
+func openAPIOperation(key string, api *config.API, schemaName string) map[string]interface{} {
+	parameters := []interface{}{commandParameter(api.Name)}
+	for _, arg := range api.Args {
+		if arg.Type != config.FAKE {
+			parameters = append(parameters, openAPIParameter(api, arg))
+		}
+	}
+	operation := map[string]interface{}{
+		"operationId":          api.Name,
+		"summary":              api.Description,
+		"tags":                 []string{api.Noun},
+		"parameters":           parameters,
+		"responses":            map[string]interface{}{"200": openAPIResponse(api, schemaName)},
+		"x-cloudstack-command": api.Name,
+		"x-cloudstack-async":   api.Async,
+	}
+	if api.Noun == "" {
+		operation["tags"] = []string{key}
+	}
+	if api.Async {
+		operation["x-cloudstack-jobresult"] = schemaRef(jobResultName(api))
+	}
+	if api.Since != "" {
+		operation["x-cloudstack-since"] = api.Since
+	}
+	if len(api.Related) > 0 {
+		operation["x-cloudstack-related"] = api.Related
+	}
+	return operation
+}
+
+// queryAsyncJobResultAPI is exported with async APIs when the API cache
+// does not have queryAsyncJobResult
+var queryAsyncJobResultAPI = &config.API{
+	Name:        "queryAsyncJobResult",
+	Verb:        "query",
+	Noun:        "AsyncJobResult",
+	Description: "Retrieves the current status of asynchronous job.",
+	Args: []*config.APIArg{
+		{Name: "jobid=", Type: "uuid", Required: true, Description: "the ID of the asynchronous job"},
+	},
+}
+
+// openAPIDocument returns the OpenAPI document of the selected APIs
+func openAPIDocument(apis map[string]*config.API, names []string, serverURL string, version string) map[string]interface{} {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[strings.ToLower(name)] = true
+	}
+	paths := make(map[string]interface{})
+	schemas := asyncJobSchemas()
+	hasAsync := false
+	for key, api := range apis {
+		if len(selected) > 0 && !selected[key] {
+			continue
+		}
+		if api == nil || api.Name == "" {
+			// entries without a name can not be named in the document
+			continue
+		}
+		schemaName := strings.ToUpper(api.Name[:1]) + api.Name[1:] + "Response"
+		schemas[schemaName] = openAPIResponseSchema(api.Response, "")
+		if api.Async {
+			hasAsync = true
+			schemas[jobResultName(api)] = jobResultSchema(schemaName)
+		}
+		paths["/"+api.Name] = map[string]interface{}{"get": openAPIOperation(key, api, schemaName)}
+	}
+	if _, found := paths["/queryAsyncJobResult"]; hasAsync && !found {
+		// the jobResult links of async APIs refer to queryAsyncJobResult,
+		// which responds with the AsyncJobResult schema
+		api := apis["queryasyncjobresult"]
+		if api == nil || api.Name == "" {
+			api = queryAsyncJobResultAPI
+		}
+		paths["/"+api.Name] = map[string]interface{}{"get": openAPIOperation("queryasyncjobresult", api, "AsyncJobResult")}
+	}
+
+	document := map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "Apache CloudStack API",
+			"version":     version,
+			"description": "Generated by cmk from its API cache. Requests are signed with the apiKey and signature query parameters.",
+		},
+		"paths": paths,
+		"x-cloudstack-adapter": map[string]interface{}{
+			"path":        "",
+			"description": "Every operation is sent to the server URL, the API endpoint, without its /<api> path. The command query param names the API.",
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "query", "name": "apiKey"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"apiKey": []string{}}},
+	}
+	if serverURL != "" {
+		document["servers"] = []interface{}{map[string]interface{}{"url": serverURL}}
+	}
+	return document
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "openapi",
+		Help:  "Exports the API cache as an OpenAPI 3 document",
+		Usage: openAPIUsage,
+		Handle: func(r *Request) error {
+			var source, output string
+			var apis []string
+			for _, arg := range r.Args {
+				switch {
+				case strings.HasPrefix(arg, "source="):
+					source = strings.TrimPrefix(arg, "source=")
+				case strings.HasPrefix(arg, "apis="):
+					apis = strings.Split(strings.TrimPrefix(arg, "apis="), ",")
+				case strings.HasPrefix(arg, "output="):
+					output = strings.TrimPrefix(arg, "output=")
+				default:
+					fmt.Println(openAPIUsage)
+					return newCommandError(ExitUsage, fmt.Errorf("unknown arg %s", arg))
+				}
+			}
+
+			cache := r.Config.GetCache()
+			serverURL, version := "", "unknown"
+			if source == "" {
+				serverURL = r.Config.ActiveProfile.URL
+				if info := r.Config.CacheSyncInfo(); info != nil && info.ServerVersion != "" {
+					version = info.ServerVersion
+				}
+			} else {
+				var err error
+				if cache, err = readAPICache(r, source); err != nil {
+					return newCommandError(ExitUsage, err)
+				}
+			}
+			warnUnknownAPIs(cache, apis)
+			document := openAPIDocument(cache, apis, serverURL, version)
+			count := len(document["paths"].(map[string]interface{}))
+			if count == 0 {
+				return newCommandError(ExitUsage, errors.New("no APIs found to export"))
+			}
+
+			content, err := json.MarshalIndent(document, "", "  ")
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				fmt.Println(string(content))
+				return nil
+			}
+			if err := os.WriteFile(output, append(content, '\n'), 0644); err != nil {
+				return err
+			}
+			fmt.Printf("Exported %d APIs to %s\n", count, output)
+			return nil
+		},
+	})
+}
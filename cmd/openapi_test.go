@@ -0,0 +1,101 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const openAPITestCache = `{"api": [
+	{"name": "listZones", "since": "4.0", "params": [
+		{"name": "id", "type": "uuid"},
+		{"name": "keyword", "type": "string", "length": 255}
+	], "response": [{"name": "id", "type": "string"}, {"name": "name", "type": "string"}]},
+	{"name": "createTags", "isasync": true, "params": [
+		{"name": "tags", "type": "map", "required": true, "description": "Map of tags (key/value pairs), e.g. tags[0].key=env&tags[0].value=prod"},
+		{"name": "resourceids", "type": "list", "required": true}
+	], "response": [{"name": "success", "type": "boolean"}]}
+]}`
+
+func TestOpenAPIDocument(t *testing.T) {
+	apis := parseTestCache(t, openAPITestCache)
+	apis["unnamed"] = &config.API{}
+	document := openAPIDocument(apis, nil, "http://localhost:8080/client/api", "4.19.0")
+
+	paths := document["paths"].(map[string]interface{})
+	var names []string
+	for path := range paths {
+		names = append(names, path)
+	}
+	expected := map[string]bool{"/listZones": true, "/createTags": true, "/queryAsyncJobResult": true}
+	if len(paths) != len(expected) {
+		t.Fatalf("expected paths %v, got %v", expected, names)
+	}
+	for _, name := range names {
+		if !expected[name] {
+			t.Errorf("unexpected path %s", name)
+		}
+	}
+
+	operation := paths["/createTags"].(map[string]interface{})["get"].(map[string]interface{})
+	parameters := make(map[string]map[string]interface{})
+	for _, parameter := range operation["parameters"].([]interface{}) {
+		parameter := parameter.(map[string]interface{})
+		parameters[parameter["name"].(string)] = parameter
+	}
+	command := parameters["command"]
+	if command["required"] != true || !reflect.DeepEqual(command["schema"].(map[string]interface{})["enum"], []string{"createTags"}) {
+		t.Errorf("expected a required command param, got %v", command)
+	}
+	tags := parameters["tags"]
+	if tags["style"] != "form" || tags["x-cloudstack-encoding"] != "tags[<index>].<key>=<value>" {
+		t.Errorf("expected the indexed map encoding of tags, got %v", tags)
+	}
+	items := tags["schema"].(map[string]interface{})["items"].(map[string]interface{})
+	if _, found := items["properties"].(map[string]interface{})["key"]; !found {
+		t.Errorf("expected the key property of tags from its description, got %v", items)
+	}
+	if resourceIDs := parameters["resourceids"]; resourceIDs["explode"] != false {
+		t.Errorf("expected comma separated resourceids, got %v", resourceIDs)
+	}
+
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"AsyncJobResponse", "AsyncJobResult", "CreateTagsResponse", "CreateTagsJobResult", "ListZonesResponse"} {
+		if schemas[name] == nil {
+			t.Errorf("expected the %s schema", name)
+		}
+	}
+	if _, found := schemas["ListZonesJobResult"]; found {
+		t.Errorf("expected no job result schema of the sync listZones API")
+	}
+	link := operation["responses"].(map[string]interface{})["200"].(map[string]interface{})["links"].(map[string]interface{})["jobResult"].(map[string]interface{})
+	if link["operationId"] != "queryAsyncJobResult" {
+		t.Errorf("expected a link to queryAsyncJobResult, got %v", link)
+	}
+
+	document = openAPIDocument(apis, []string{"ListZones", "listNothing"}, "", "unknown")
+	if paths := document["paths"].(map[string]interface{}); len(paths) != 1 || paths["/listZones"] == nil {
+		t.Errorf("expected only listZones to be exported, got %v", paths)
+	}
+	if _, found := document["servers"]; found {
+		t.Errorf("expected no servers without a server URL")
+	}
+}
@@ -21,9 +21,11 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
@@ -47,9 +49,11 @@ func jsonify(value interface{}, format string) string {
 			value = string(jsonStr)
 		}
 	}
-	switch value.(type) {
-	case float64, float32:
-		return fmt.Sprintf("%.f", value)
+	switch value := value.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
 	default:
 		return fmt.Sprintf("%v", value)
 	}
@@ -189,8 +193,12 @@ func printColumn(response map[string]interface{}, filter []string) {
 }
 
 func printCsv(response map[string]interface{}, filter []string) {
+	writeCsv(os.Stdout, response, filter)
+}
+
+func writeCsv(w io.Writer, response map[string]interface{}, filter []string) error {
 	format := "csv"
-	enc := csv.NewWriter(os.Stdout)
+	enc := csv.NewWriter(w)
 	for _, v := range response {
 		valueType := reflect.TypeOf(v)
 		if valueType.Kind() == reflect.Slice || valueType.Kind() == reflect.Map {
@@ -225,6 +233,7 @@ func printCsv(response map[string]interface{}, filter []string) {
 		}
 	}
 	enc.Flush()
+	return enc.Error()
 }
 
 func filterResponse(response map[string]interface{}, filter []string, excludeFilter []string, outputType string) map[string]interface{} {
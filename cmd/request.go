@@ -29,6 +29,10 @@ type Request struct {
 	Config              *config.Config
 	Args                []string
 	CredentialsSupplied bool
+
+	// Progress receives the progress of the API calls of a command which draws
+	// its own progress, such as foreach, instead of starting spinners
+	Progress func(message string)
 }
 
 // Client method returns the http Client for the current server profile
@@ -45,3 +49,11 @@ func NewRequest(cmd *Command, cfg *config.Config, args []string, credentialsSupp
 		CredentialsSupplied: credentialsSupplied,
 	}
 }
+
+// WithProgress returns a copy of a request whose API calls report their
+// progress to a progress sink
+func (r *Request) WithProgress(progress func(message string)) *Request {
+	request := *r
+	request.Progress = progress
+	return &request
+}
@@ -0,0 +1,214 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+// nameRefPrefix marks the value of an id arg as the name of the resource
+const nameRefPrefix = "name:"
+
+var idPattern = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9]+)$`)
+
+// listFilterDefaults are the values used for required args of list APIs when
+// looking up resources by name
+var listFilterDefaults = map[string]string{
+	"templatefilter": "executable",
+	"isofilter":      "executable",
+}
+
+// idResolver looks up the ids of resources by name, caching the results
+type idResolver struct {
+	r     *Request
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newIDResolver(r *Request) *idResolver {
+	return &idResolver{r: r, cache: make(map[string]string)}
+}
+
+// isResourceID returns true if a value looks like a resource id
+func isResourceID(value string) bool {
+	return idPattern.MatchString(value)
+}
+
+// findNounListAPI returns the list API for a singular or plural noun
+func findNounListAPI(r *Request, noun string) *config.API {
+	apiMap := r.Config.GetAPIVerbMap()
+	nouns := []string{config.PluralNoun(noun), noun}
+	if strings.HasSuffix(noun, "y") {
+		nouns = append(nouns, strings.TrimSuffix(noun, "y")+"ies")
+	}
+	for _, candidate := range nouns {
+		if api := config.FindListAPI(apiMap, candidate); api != nil {
+			return api
+		}
+	}
+	return nil
+}
+
+// findListAPI returns the list API for the resources referenced by an id arg
+func findListAPI(r *Request, param string) *config.API {
+	param = strings.ToLower(param)
+	noun := strings.TrimSuffix(param, "id")
+	if noun == "" || noun == param {
+		return nil
+	}
+	return findNounListAPI(r, noun)
+}
+
+// relatedListAPI returns the list API for the resources an id arg of an API
+// refers to
+func relatedListAPI(r *Request, api *config.API, param string) *config.API {
+	if api != nil {
+		for _, arg := range api.Args {
+			if strings.EqualFold(arg.Name, param+"=") {
+				if listAPI := config.FindRelatedListAPI(arg, api, r.Config.GetAPIVerbMap()); listAPI != nil {
+					return listAPI
+				}
+			}
+		}
+	}
+	return findListAPI(r, param)
+}
+
+// listParams returns the params to look up resources using a list API, or an
+// error if the API requires an arg without a known default
+func listParams(api *config.API) (url.Values, error) {
+	params := make(url.Values)
+	for _, required := range api.RequiredArgs {
+		required = strings.TrimSuffix(required, "=")
+		value, ok := listFilterDefaults[required]
+		if !ok {
+			return nil, fmt.Errorf("%s requires %s", api.Name, required)
+		}
+		params.Set(required, value)
+	}
+	if api.HasArg("listall=") {
+		params.Set("listall", "true")
+	}
+	return params, nil
+}
+
+// resolve returns the id of the resource named name referenced by an id arg
+// of an API, such as zoneid
+func (res *idResolver) resolve(ctx context.Context, forAPI *config.API, param string, name string) (string, error) {
+	api := relatedListAPI(res.r, forAPI, param)
+	if api == nil {
+		return "", newCommandError(ExitMissingParams, fmt.Errorf("unable to resolve %s=%s, no list API found for %s", param, name, param))
+	}
+	key := api.Name + "=" + name
+	res.mu.Lock()
+	id, found := res.cache[key]
+	res.mu.Unlock()
+	if found {
+		return id, nil
+	}
+	params, err := listParams(api)
+	if err != nil {
+		return "", newCommandError(ExitMissingParams, fmt.Errorf("unable to resolve %s=%s, %v", param, name, err))
+	}
+	if api.HasArg("name=") {
+		params.Set("name", name)
+	} else if api.HasArg("keyword=") {
+		params.Set("keyword", name)
+	}
+
+	_, items, err := NewClient(res.r).ListAll(ctx, api.Name, params, 0)
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for _, item := range items {
+		resource, ok := item.(map[string]interface{})
+		if ok && strings.EqualFold(fmt.Sprint(resource["name"]), name) && resource["id"] != nil {
+			ids = append(ids, fmt.Sprint(resource["id"]))
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return "", newCommandError(ExitMissingParams, fmt.Errorf("unable to resolve %s=%s, no resource found by %s", param, name, api.Name))
+	case 1:
+		res.mu.Lock()
+		res.cache[key] = ids[0]
+		res.mu.Unlock()
+		return ids[0], nil
+	}
+	return "", newCommandError(ExitMissingParams, fmt.Errorf("unable to resolve %s=%s, %d resources found by %s: %s", param, name, len(ids), api.Name, strings.Join(ids, ", ")))
+}
+
+// resolvedArgName returns the id arg of an API that an arg names a resource
+// for, such as zoneid for zone, or the arg itself
+func resolvedArgName(api *config.API, key string) string {
+	if api != nil && !api.HasArg(key+"=") && api.HasArg(key+"id=") {
+		return key + "id"
+	}
+	return key
+}
+
+// resolveArgs replaces resource names in the args of an API with their ids,
+// for args such as zoneid=name:zone1, or zone=zone1 for APIs with a zoneid arg
+func resolveArgs(ctx context.Context, r *Request, api *config.API, args []string) ([]string, error) {
+	if api == nil {
+		return args, nil
+	}
+	var resolver *idResolver
+	resolved := make([]string, 0, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			resolved = append(resolved, arg)
+			continue
+		}
+		key, value := parts[0], parts[1]
+		param := resolvedArgName(api, key)
+		isIDArg := strings.HasSuffix(param, "id") || strings.HasSuffix(param, "ids")
+		if param == key && !(isIDArg && strings.HasPrefix(value, nameRefPrefix)) {
+			resolved = append(resolved, arg)
+			continue
+		}
+		value = strings.TrimPrefix(value, nameRefPrefix)
+		names := []string{value}
+		if strings.HasSuffix(param, "ids") {
+			names = strings.Split(value, ",")
+		}
+		if resolver == nil {
+			resolver = newIDResolver(r)
+		}
+		var ids []string
+		for _, name := range names {
+			id, err := resolver.resolve(ctx, api, param, name)
+			if err != nil {
+				return nil, err
+			}
+			config.Debug("Resolved ", param, "=", name, " to ", id)
+			ids = append(ids, id)
+		}
+		resolved = append(resolved, param+"="+strings.Join(ids, ","))
+	}
+	return resolved, nil
+}
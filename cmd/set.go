@@ -26,26 +26,45 @@ import (
 	"github.com/apache/cloudstack-cloudmonkey/config"
 )
 
+// sub-commands whose listed values are suggestions rather than the only valid values
+var numericSubCommands = []string{"timeout", "pollinterval", "pollbackoff", "pollmaxinterval", "completionttl", "syncmaxage", "ratelimit", "rateburst", "maxinflight"}
+
 func init() {
 	AddCommand(&Command{
 		Name: "set",
 		Help: "Configures options for cmk",
 		SubCommands: map[string][]string{
-			"prompt":       {"🐵", "🐱", "random"},
-			"asyncblock":   {"true", "false"},
-			"timeout":      {"600", "1800", "3600"},
-			"output":       config.GetOutputFormats(),
-			"profile":      {},
-			"url":          {},
-			"username":     {},
-			"password":     {},
-			"domain":       {},
-			"apikey":       {},
-			"secretkey":    {},
-			"verifycert":   {"true", "false"},
-			"debug":        {"true", "false"},
-			"autocomplete": {"true", "false"},
-			"postrequest":  {"true", "false"},
+			"prompt":            {"🐵", "🐱", "random"},
+			"asyncblock":        {"true", "false"},
+			"timeout":           {"600", "1800", "3600"},
+			"output":            config.GetOutputFormats(),
+			"profile":           {},
+			"url":               {},
+			"username":          {},
+			"password":          {},
+			"domain":            {},
+			"apikey":            {},
+			"secretkey":         {},
+			"verifycert":        {"true", "false"},
+			"debug":             {"true", "false"},
+			"autocomplete":      {"true", "false"},
+			"postrequest":       {"true", "false"},
+			"record":            {},
+			"replay":            {},
+			"trace":             {},
+			"pollinterval":      {"1", "2", "5", "10"},
+			"pollbackoff":       {"1", "1.5", "2"},
+			"pollmaxinterval":   {"10", "30", "60"},
+			"detachoninterrupt": {"true", "false"},
+			"completion":        {"fuzzy", "prefix"},
+			"strict":            {"true", "false"},
+			"autosync":          {"auto", "prompt", "off"},
+			"syncmaxage":        {"0", "7", "30", "90"},
+			"completionttl":     {"0", "60", "300", "3600"},
+			"completiondisk":    {"true", "false"},
+			"ratelimit":         {"0", "5", "10", "20"},
+			"rateburst":         {"1", "5", "10"},
+			"maxinflight":       {"0", "2", "5", "10"},
 		},
 		Handle: func(r *Request) error {
 			if len(r.Args) < 1 {
@@ -63,7 +82,7 @@ func init() {
 				subCommand = "output"
 			}
 			validArgs := r.Command.SubCommands[subCommand]
-			if len(validArgs) != 0 && subCommand != "timeout" {
+			if len(validArgs) != 0 && !config.CheckIfValuePresent(numericSubCommands, subCommand) {
 				if !config.CheckIfValuePresent(validArgs, value) {
 					return errors.New("Invalid value set for " + subCommand + ". Supported values: " + strings.Join(validArgs, ", "))
 				}
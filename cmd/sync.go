@@ -18,22 +18,162 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/briandowns/spinner"
 )
 
+const syncCheckArg = "--check"
+
+// serverVersion returns the CloudStack version of the management server
+func serverVersion(ctx context.Context, r *Request) (string, error) {
+	response, err := apiRequest(ctx, r, "listCapabilities", nil, false)
+	if err != nil {
+		return "", err
+	}
+	if capability, ok := response["capability"].(map[string]interface{}); ok {
+		if version, ok := capability["cloudstackversion"].(string); ok {
+			return version, nil
+		}
+	}
+	return "", errors.New("server version not found in listCapabilities response")
+}
+
+// syncAPIs discovers the APIs of the management server and updates the API cache
+func syncAPIs(ctx context.Context, r *Request) (interface{}, error) {
+	response, err := apiRequest(ctx, r, "listApis", []string{"listall=true"}, false)
+	if err != nil {
+		return nil, err
+	}
+	version, err := serverVersion(ctx, r)
+	if err != nil {
+		config.Debug("Failed to find server version: ", err)
+	}
+	count, err := r.Config.UpdateCache(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse discovered APIs: %v", err)
+	}
+	r.Config.SaveCache(response, version)
+	return count, nil
+}
+
+// cacheDrift returns the reasons the API cache may be out of date with the
+// management server, the server version is only checked when checkServer is set
+func cacheDrift(ctx context.Context, r *Request, checkServer bool) ([]string, error) {
+	info := r.Config.CacheSyncInfo()
+	if info == nil {
+		return []string{"the in-built API cache is used"}, nil
+	}
+	var reasons []string
+	maxAge := time.Duration(r.Config.Core.SyncMaxAge) * 24 * time.Hour
+	if age := time.Since(info.Synced); maxAge > 0 && age > maxAge {
+		reasons = append(reasons, fmt.Sprintf("the API cache was synced %d days ago", int(age.Hours()/24)))
+	}
+	if checkServer {
+		version, err := serverVersion(ctx, r)
+		if err != nil {
+			return reasons, err
+		}
+		if info.ServerVersion == "" {
+			reasons = append(reasons, fmt.Sprintf("the API cache was synced from an unknown server version, the server runs %s", version))
+		} else if version != info.ServerVersion {
+			reasons = append(reasons, fmt.Sprintf("the server version changed from %s to %s", info.ServerVersion, version))
+		}
+	}
+	return reasons, nil
+}
+
+// autoSyncTimeout is the time allowed for the background server version check
+const autoSyncTimeout = 10 * time.Second
+
+// AutoSync checks whether the API cache is out of date and, depending on the
+// autosync setting, syncs it or asks the user to sync. Messages are written to
+// w. Only the age of the API cache is checked before returning, the server
+// version is checked in the background when checkServer is set and the API
+// keys of the profile are set, so that no login is needed.
+func AutoSync(r *Request, w io.Writer, checkServer bool) {
+	mode := r.Config.Core.AutoSync
+	if mode == "off" || mode == "" {
+		return
+	}
+	if r.Config.CacheSyncInfo() == nil && mode != "auto" {
+		// loading the in-built API cache already asks the user to sync
+		return
+	}
+	if reasons, _ := cacheDrift(context.Background(), r, false); len(reasons) > 0 {
+		syncStaleCache(requestContext(r), r, w, reasons, true)
+		return
+	}
+	profile := r.Config.ActiveProfile
+	if !checkServer || profile.APIKey == "" || profile.SecretKey == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), autoSyncTimeout)
+		reasons, err := cacheDrift(ctx, r, true)
+		cancel()
+		if err != nil {
+			config.Debug("Failed to check API cache drift: ", err)
+		}
+		if len(reasons) > 0 {
+			syncStaleCache(context.Background(), r, w, reasons, false)
+		}
+	}()
+}
+
+// syncStaleCache syncs the out of date API cache when autosync is auto, and
+// otherwise asks the user to sync
+func syncStaleCache(ctx context.Context, r *Request, w io.Writer, reasons []string, showSpinner bool) {
+	if r.Config.Core.AutoSync != "auto" {
+		fmt.Fprintf(w, "API cache may be out of date, %s. Please run 'sync'.\n", strings.Join(reasons, ", "))
+		return
+	}
+	var waiter *spinner.Spinner
+	if showSpinner {
+		waiter = r.Config.StartSpinner("discovering APIs, please wait...")
+	}
+	count, err := syncAPIs(ctx, r)
+	r.Config.StopSpinner(waiter)
+	if err != nil {
+		fmt.Fprintln(w, "Failed to sync API cache:", err)
+		return
+	}
+	fmt.Fprintf(w, "API cache was out of date, %s. Synced and discovered %v APIs\n", strings.Join(reasons, ", "), count)
+}
+
 func init() {
 	AddCommand(&Command{
 		Name: "sync",
-		Help: "Discovers and updates APIs",
+		Help: "Discovers and updates APIs, use --check to only report drift",
 		Handle: func(r *Request) error {
+			ctx := requestContext(r)
+			if len(r.Args) > 0 && r.Args[0] == syncCheckArg {
+				spinner := r.Config.StartSpinner("checking API cache, please wait...")
+				reasons, err := cacheDrift(ctx, r, true)
+				r.Config.StopSpinner(spinner)
+				if err != nil {
+					return err
+				}
+				info := r.Config.CacheSyncInfo()
+				if len(reasons) > 0 {
+					return newCommandError(ExitError, fmt.Errorf("API cache is out of date: %s", strings.Join(reasons, ", ")))
+				}
+				fmt.Printf("API cache is up to date, synced %s from server version %s with %d APIs\n", info.Synced.Local().Format(time.RFC1123), info.ServerVersion, info.APICount)
+				return nil
+			}
 			spinner := r.Config.StartSpinner("discovering APIs, please wait...")
-			response, err := NewAPIRequest(r, "listApis", []string{"listall=true"}, false)
+			count, err := syncAPIs(ctx, r)
 			r.Config.StopSpinner(spinner)
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Discovered %v APIs\n", r.Config.UpdateCache(response))
-			r.Config.SaveCache(response)
+			fmt.Printf("Discovered %v APIs\n", count)
 			return nil
 		},
 	})
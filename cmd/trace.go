@@ -0,0 +1,142 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/olekukonko/tablewriter"
+)
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// PrintTraceSummary prints per-phase timings of traced requests, the session
+// totals and the number of async job result polls per job
+func PrintTraceSummary(w io.Writer, entries []config.TraceEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No API requests traced, enable tracing using: set trace <file.har|->")
+		return
+	}
+
+	var total config.TraceEntry
+	var jobIDs []string
+	polls := make(map[string]int)
+	pollTime := make(map[string]time.Duration)
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"#", "API", "Status", "Blocked", "DNS", "Connect", "TLS", "Send", "Wait", "Receive", "Total"})
+	for idx, entry := range entries {
+		status := strconv.Itoa(entry.Status)
+		if entry.Error != "" {
+			status = "error"
+		}
+		table.Append([]string{
+			strconv.Itoa(idx + 1),
+			entry.Command,
+			status,
+			formatDuration(entry.Blocked),
+			formatDuration(entry.DNS),
+			formatDuration(entry.Connect),
+			formatDuration(entry.TLS),
+			formatDuration(entry.Send),
+			formatDuration(entry.Wait),
+			formatDuration(entry.Receive),
+			formatDuration(entry.Total),
+		})
+		total.Blocked += entry.Blocked
+		total.DNS += entry.DNS
+		total.Connect += entry.Connect
+		total.TLS += entry.TLS
+		total.Send += entry.Send
+		total.Wait += entry.Wait
+		total.Receive += entry.Receive
+		total.Total += entry.Total
+
+		if entry.JobID != "" {
+			if _, found := polls[entry.JobID]; !found {
+				jobIDs = append(jobIDs, entry.JobID)
+			}
+			polls[entry.JobID]++
+			pollTime[entry.JobID] += entry.Total
+		}
+	}
+	table.Append([]string{"", "total", "", formatDuration(total.Blocked), formatDuration(total.DNS),
+		formatDuration(total.Connect), formatDuration(total.TLS), formatDuration(total.Send),
+		formatDuration(total.Wait), formatDuration(total.Receive), formatDuration(total.Total)})
+	table.Render()
+
+	if len(jobIDs) > 0 {
+		jobTable := tablewriter.NewWriter(w)
+		jobTable.SetHeader([]string{"Job ID", "Polls", "Polling Time"})
+		for _, jobID := range jobIDs {
+			jobTable.Append([]string{jobID, strconv.Itoa(polls[jobID]), formatDuration(pollTime[jobID])})
+		}
+		jobTable.Render()
+	}
+}
+
+func init() {
+	AddCommand(&Command{
+		Name: "trace",
+		Help: "Shows or exports API request timings",
+		SubCommands: map[string][]string{
+			"summary": {},
+			"har":     {},
+			"clear":   {},
+		},
+		Handle: func(r *Request) error {
+			if r.Config.TraceFile == "" {
+				fmt.Println("Tracing is disabled, enable it using: set trace <file.har|->")
+				return nil
+			}
+			subCommand := "summary"
+			if len(r.Args) > 0 {
+				subCommand = r.Args[0]
+			}
+			switch subCommand {
+			case "summary":
+				PrintTraceSummary(os.Stdout, r.Config.TraceEntries())
+			case "har":
+				fileName := r.Config.TraceFile
+				if len(r.Args) > 1 {
+					fileName = r.Args[1]
+				}
+				if fileName == config.TraceSummaryOnly {
+					return errors.New("please provide the HAR file to export to")
+				}
+				if err := r.Config.ExportTraceHAR(fileName); err != nil {
+					return err
+				}
+				fmt.Println("Exported", len(r.Config.TraceEntries()), "traced requests to", fileName)
+			case "clear":
+				r.Config.ClearTrace()
+			default:
+				fmt.Println("Usage: trace [summary|har [file]|clear]")
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,225 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+// dateLayouts are the date formats accepted by the management server
+var dateLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04:05-0700", "2006-01-02T15:04:05Z07:00"}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// minInt returns the smallest of the values
+func minInt(values ...int) int {
+	result := values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+// suggestArg returns the arg of an API closest to an unknown arg name
+func suggestArg(api *config.API, name string) string {
+	suggestion := ""
+	best := len(name)/3 + 2
+	for _, arg := range api.Args {
+		argName := strings.TrimSuffix(arg.Name, "=")
+		distance := editDistance(name, argName)
+		if strings.HasPrefix(argName, name) || strings.HasPrefix(name, argName) {
+			distance = minInt(distance, 2)
+		}
+		if distance < best {
+			best = distance
+			suggestion = argName
+		}
+	}
+	return suggestion
+}
+
+// findArg returns the arg of an API for an arg name, ignoring case and the
+// index of map args such as details[0].key
+func findArg(api *config.API, name string) *config.APIArg {
+	if idx := strings.Index(name, "["); idx > 0 {
+		name = name[:idx]
+	}
+	for _, arg := range api.Args {
+		if strings.EqualFold(arg.Name, name+"=") {
+			return arg
+		}
+	}
+	return nil
+}
+
+// validateValue checks a value against the type and length of an API arg
+func validateValue(arg *config.APIArg, value string) error {
+	if arg.Type != "map" && arg.Length > 0 && utf8.RuneCountInString(value) > arg.Length {
+		return fmt.Errorf("exceeds the maximum length of %d", arg.Length)
+	}
+	switch arg.Type {
+	case "uuid":
+		if !isResourceID(value) {
+			return errors.New("is not a valid id")
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("is not a boolean, use true or false")
+		}
+	case "integer", "short", "long":
+		bits := map[string]int{"short": 16, "integer": 32, "long": 64}[arg.Type]
+		if _, err := strconv.ParseInt(value, 10, bits); err != nil {
+			return fmt.Errorf("is not a valid %s", arg.Type)
+		}
+	case "date", "tzdate":
+		for _, layout := range dateLayouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return nil
+			}
+		}
+		return errors.New("is not a valid date, use yyyy-MM-dd or yyyy-MM-dd HH:mm:ss")
+	case "map":
+		if isMapSyntax(value) {
+			if _, err := expandMapArg(arg.Name, value); err != nil {
+				return fmt.Errorf("is not a valid map, %v", err)
+			}
+		}
+	case "list":
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			value = value[1 : len(value)-1]
+		}
+		for _, item := range strings.Split(value, ",") {
+			if len(strings.TrimSpace(item)) == 0 {
+				return errors.New("has an empty list item")
+			}
+			if strings.HasSuffix(arg.Name, "ids=") && !isResourceID(strings.TrimSpace(item)) {
+				return fmt.Errorf("has an invalid id %s", item)
+			}
+		}
+	}
+	return nil
+}
+
+// unquoteValue returns an arg value without the double quotes around it
+func unquoteValue(value string) string {
+	if len(value) > 1 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// knownArgs returns the args whose values do not contain the placeholder,
+// which are only known when the API runs
+func knownArgs(args []string, placeholder string) []string {
+	var known []string
+	for _, arg := range args {
+		if placeholder == "" || !strings.Contains(arg, placeholder) {
+			known = append(known, arg)
+		}
+	}
+	return known
+}
+
+// validateArgs checks the args of an API against the types, lengths and
+// names of the args in the API cache
+func validateArgs(api *config.API, args []string) []string {
+	var problems []string
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := parts[0], unquoteValue(parts[1])
+		apiArg := findArg(api, key)
+		if apiArg == nil {
+			if resolvedArgName(api, key) != key {
+				continue
+			}
+			problem := fmt.Sprintf("unknown parameter %s for %s", key, api.Name)
+			if suggestion := suggestArg(api, strings.ToLower(key)); suggestion != "" {
+				problem += fmt.Sprintf(", did you mean %s?", suggestion)
+			}
+			problems = append(problems, problem)
+			continue
+		}
+		if apiArg.Type == config.FAKE || strings.Contains(key, "[") || len(value) == 0 || strings.HasPrefix(value, "@") || strings.HasPrefix(value, nameRefPrefix) {
+			continue
+		}
+		if err := validateValue(apiArg, value); err != nil {
+			problems = append(problems, fmt.Sprintf("value %s of %s %v", value, key, err))
+		}
+	}
+	return problems
+}
+
+// checkArgs validates the args of the API requests of a command once before
+// they are run, problems are printed as warnings unless strict validation is
+// enabled, in which case they fail the command
+func checkArgs(r *Request, api *config.API, argSets ...[]string) error {
+	var problems []string
+	seen := make(map[string]bool)
+	for _, args := range argSets {
+		for _, problem := range validateArgs(api, args) {
+			if !seen[problem] {
+				seen[problem] = true
+				problems = append(problems, problem)
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if r.Config.Core.Strict {
+		err := newCommandError(ExitMissingParams, errors.New("invalid parameters: "+strings.Join(problems, "; ")))
+		err.Details = map[string]interface{}{"api": api.Name, "problems": problems}
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, "Warning:", problem)
+	}
+	return nil
+}
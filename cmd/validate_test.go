@@ -0,0 +1,103 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		argName string
+		argType string
+		length  int
+		value   string
+		valid   bool
+	}{
+		{"id=", "uuid", 0, "3c7a5b52-1cf5-4fbd-8a57-6d0b3d7e1e4f", true},
+		{"id=", "uuid", 0, "vm-1", false},
+		{"isrecursive=", "boolean", 0, "true", true},
+		{"isrecursive=", "boolean", 0, "yes", false},
+		{"page=", "integer", 0, "10", true},
+		{"page=", "integer", 0, "ten", false},
+		{"port=", "short", 0, "70000", false},
+		{"size=", "long", 0, "9000000000", true},
+		{"startdate=", "date", 0, "2024-01-31", true},
+		{"startdate=", "date", 0, "2024-01-31 10:20:30", true},
+		{"startdate=", "date", 0, "31/01/2024", false},
+		{"name=", "string", 5, "vm-1", true},
+		{"name=", "string", 5, "vm-100", false},
+		{"details=", "map", 0, "{cpuSpeed:1000,memory:2048}", true},
+		{"details=", "map", 0, "{cpuSpeed}", false},
+		{"tags=", "map", 0, "env=prod,team=core", true},
+		{"tags=", "map", 0, "env=prod,team", false},
+		{"keywords=", "list", 0, "[a,b]", true},
+		{"keywords=", "list", 0, "a,,b", false},
+		{"ids=", "list", 0, "3c7a5b52-1cf5-4fbd-8a57-6d0b3d7e1e4f", true},
+		{"ids=", "list", 0, "vm-1", false},
+	}
+	for _, test := range tests {
+		arg := &config.APIArg{Name: test.argName, Type: test.argType, Length: test.length}
+		if err := validateValue(arg, test.value); (err == nil) != test.valid {
+			t.Errorf("validateValue(%s %s, %q) = %v, expected valid %v", test.argName, test.argType, test.value, err, test.valid)
+		}
+	}
+}
+
+func TestSuggestArg(t *testing.T) {
+	api := &config.API{
+		Name: "listVirtualMachines",
+		Args: []*config.APIArg{
+			{Name: "zoneid=", Type: "uuid"},
+			{Name: "templateid=", Type: "uuid"},
+			{Name: "keyword=", Type: "string"},
+			{Name: "isrecursive=", Type: "boolean"},
+		},
+	}
+	tests := []struct {
+		name       string
+		suggestion string
+	}{
+		{"zoneid", "zoneid"},
+		{"zonid", "zoneid"},
+		{"zone", "zoneid"},
+		{"keywrd", "keyword"},
+		{"recursive", "isrecursive"},
+		{"hypervisor", ""},
+	}
+	for _, test := range tests {
+		if suggestion := suggestArg(api, test.name); suggestion != test.suggestion {
+			t.Errorf("suggestArg(%q) = %q, expected %q", test.name, suggestion, test.suggestion)
+		}
+	}
+}
+
+func TestValidateArgsUnquotesValues(t *testing.T) {
+	api := &config.API{
+		Name: "listVirtualMachines",
+		Args: []*config.APIArg{{Name: "isrecursive=", Type: "boolean"}},
+	}
+	if problems := validateArgs(api, []string{`isrecursive="true"`}); len(problems) > 0 {
+		t.Errorf("expected a quoted boolean to be valid, got %v", problems)
+	}
+	if problems := validateArgs(api, []string{"recursive=true"}); len(problems) != 1 {
+		t.Errorf("expected an unknown parameter problem, got %v", problems)
+	}
+}
@@ -0,0 +1,213 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+const waitUsage = `Usage: wait <noun> id=<id> [state=Running] [<field>=<value>...] [timeout=<seconds>] [interval=<seconds>]
+
+Polls the list API of a resource, such as virtualmachine or volume, until all
+the provided fields match, for example state=Running, and prints the resource.
+A field may list several accepted values separated by |. Waiting fails when the
+resource is not found, or its state is one of the error states such as Error.`
+
+// errorStates are resource states which are not expected to change by waiting
+var errorStates = []string{"Error", "Failed", "Destroyed", "Expunging", "Expunged"}
+
+type waitOptions struct {
+	id         string
+	conditions map[string][]string
+	timeout    time.Duration
+	interval   time.Duration
+}
+
+func parseWaitOptions(r *Request, args []string) (waitOptions, error) {
+	opts := waitOptions{
+		conditions: make(map[string][]string),
+		timeout:    time.Duration(r.Config.Core.Timeout) * time.Second,
+		interval:   time.Duration(r.Config.Core.PollInterval) * time.Second,
+	}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return opts, fmt.Errorf("invalid arg %s, expected <field>=<value>", arg)
+		}
+		key, value := strings.ToLower(parts[0]), parts[1]
+		switch key {
+		case "id":
+			opts.id = value
+		case "timeout", "interval":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				return opts, fmt.Errorf("invalid %s, a positive number of seconds is required", key)
+			}
+			if key == "timeout" {
+				opts.timeout = time.Duration(seconds * float64(time.Second))
+			} else {
+				opts.interval = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			opts.conditions[key] = strings.Split(value, "|")
+		}
+	}
+	if opts.id == "" {
+		return opts, errors.New("please provide the id of the resource to wait for")
+	}
+	if len(opts.conditions) == 0 {
+		opts.conditions["state"] = []string{"Running"}
+	}
+	if opts.interval <= 0 {
+		opts.interval = 2 * time.Second
+	}
+	return opts, nil
+}
+
+// fieldValue returns a field of a resource, matching the field name case insensitively
+func fieldValue(resource map[string]interface{}, field string) string {
+	for key, value := range resource {
+		if strings.EqualFold(key, field) {
+			return jsonify(value, "text")
+		}
+	}
+	return ""
+}
+
+// waitStatus describes the fields of a resource being waited for
+func waitStatus(resource map[string]interface{}, conditions map[string][]string) string {
+	var fields []string
+	for field := range conditions {
+		fields = append(fields, field+"="+fieldValue(resource, field))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ", ")
+}
+
+// checkWait returns true if a resource matches all the conditions, or an error
+// if it is in an error state
+func checkWait(resource map[string]interface{}, conditions map[string][]string) (bool, error) {
+	matched := true
+	for field, values := range conditions {
+		if !config.CheckIfValuePresent(values, fieldValue(resource, field)) {
+			matched = false
+		}
+	}
+	if matched {
+		return true, nil
+	}
+	state := fieldValue(resource, "state")
+	if config.CheckIfValuePresent(errorStates, state) && !config.CheckIfValuePresent(conditions["state"], state) {
+		return false, fmt.Errorf("resource is in the %s state", state)
+	}
+	return false, nil
+}
+
+// waitForResource polls a list API until the resource matches the conditions
+func waitForResource(ctx context.Context, r *Request, api *config.API, noun string, opts waitOptions) (map[string]interface{}, error) {
+	params, err := listParams(api)
+	if err != nil {
+		return nil, newCommandError(ExitUsage, err)
+	}
+	params.Set("id", opts.id)
+
+	apiClient := NewClient(r)
+	timeout := time.NewTimer(opts.timeout)
+	defer timeout.Stop()
+	startTime := time.Now()
+	waiter := r.Config.StartSpinner(fmt.Sprintf("waiting for %s %s...", noun, opts.id))
+	defer r.Config.StopSpinner(waiter)
+
+	for {
+		response, err := apiClient.Call(ctx, api.Name, params)
+		if err != nil {
+			return nil, err
+		}
+		items := watchItems(response)
+		if len(items) == 0 {
+			cmdErr := newCommandError(ExitErrorState, fmt.Errorf("%s %s not found", noun, opts.id))
+			cmdErr.Details = map[string]interface{}{"id": opts.id}
+			return nil, cmdErr
+		}
+		resource := items[0]
+		matched, err := checkWait(resource, opts.conditions)
+		if matched {
+			return response, nil
+		}
+		status := waitStatus(resource, opts.conditions)
+		if err != nil {
+			cmdErr := newCommandError(ExitErrorState, fmt.Errorf("%s %s: %v", noun, opts.id, err))
+			cmdErr.Details = map[string]interface{}{"id": opts.id, "state": fieldValue(resource, "state")}
+			return response, cmdErr
+		}
+		r.Config.UpdateSpinner(waiter, fmt.Sprintf("waiting for %s %s, currently %s, elapsed %s", noun, opts.id, status, time.Since(startTime).Truncate(time.Second)))
+
+		poll := time.NewTimer(opts.interval)
+		select {
+		case <-ctx.Done():
+			poll.Stop()
+			return nil, ctx.Err()
+		case <-timeout.C:
+			poll.Stop()
+			cmdErr := newCommandError(ExitTimeout, fmt.Errorf("timed out waiting for %s %s, currently %s", noun, opts.id, status))
+			cmdErr.Details = map[string]interface{}{"id": opts.id, "state": fieldValue(resource, "state")}
+			return response, cmdErr
+		case <-poll.C:
+		}
+	}
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "wait",
+		Help:  "Waits for a resource to reach a state",
+		Usage: waitUsage,
+		Handle: func(r *Request) error {
+			if len(r.Args) < 2 {
+				fmt.Println(waitUsage)
+				return nil
+			}
+			noun := strings.ToLower(r.Args[0])
+			api := findNounListAPI(r, noun)
+			if api == nil {
+				return newCommandError(ExitUsage, fmt.Errorf("no list API found for %s", noun))
+			}
+			opts, err := parseWaitOptions(r, r.Args[1:])
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+
+			response, err := waitForResource(requestContext(r), r, api, noun, opts)
+			if errors.Is(err, context.Canceled) && r.Config.HasShell {
+				return nil
+			}
+			if response != nil && (err == nil || ExitCode(err) == ExitErrorState) {
+				printResult(r.Config.Core.Output, response, nil, nil)
+			}
+			return err
+		},
+	})
+}
@@ -0,0 +1,299 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+const watchUsage = `Usage: watch [interval=5] [until=<key=value|key!=value|empty>] <API> [args...]
+
+Runs an API every interval seconds and redraws its result as a table,
+highlighting the rows and cells changed since the previous run. Watching stops
+on Ctrl+C, or once the until condition holds for all listed resources, for
+example until=state=Running, or until=empty once no resources are listed.`
+
+const clearScreen = "\033[H\033[2J"
+
+var (
+	watchAddedColors   = tablewriter.Colors{tablewriter.FgGreenColor}
+	watchChangedColors = tablewriter.Colors{tablewriter.Bold, tablewriter.FgYellowColor}
+)
+
+// watchCondition describes when to stop watching an API
+type watchCondition struct {
+	key    string
+	value  string
+	negate bool
+	empty  bool
+}
+
+// watchSnapshot holds the rendered cells of each row by row key and column
+type watchSnapshot map[string]map[string]string
+
+func parseWatchCondition(until string) (*watchCondition, error) {
+	if until == "empty" {
+		return &watchCondition{empty: true}, nil
+	}
+	if parts := strings.SplitN(until, "!=", 2); len(parts) == 2 && len(parts[0]) > 0 {
+		return &watchCondition{key: parts[0], value: parts[1], negate: true}, nil
+	}
+	if parts := strings.SplitN(until, "=", 2); len(parts) == 2 && len(parts[0]) > 0 {
+		return &watchCondition{key: parts[0], value: parts[1]}, nil
+	}
+	return nil, fmt.Errorf("invalid watch condition: %s", until)
+}
+
+// met returns true if the condition holds for all listed resources
+func (c *watchCondition) met(items []map[string]interface{}) bool {
+	if c.empty {
+		return len(items) == 0
+	}
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if (jsonify(item[c.key], "text") == c.value) == c.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func parseWatchOptions(args []string) (time.Duration, *watchCondition, []string, error) {
+	interval := defaultWatchInterval
+	var condition *watchCondition
+	for len(args) > 0 {
+		switch {
+		case strings.HasPrefix(args[0], "interval="):
+			seconds, err := strconv.ParseFloat(strings.TrimPrefix(args[0], "interval="), 64)
+			if err != nil || seconds <= 0 {
+				return interval, nil, nil, fmt.Errorf("invalid watch interval: %s", args[0])
+			}
+			interval = time.Duration(seconds * float64(time.Second))
+		case strings.HasPrefix(args[0], "until="):
+			var err error
+			if condition, err = parseWatchCondition(strings.TrimPrefix(args[0], "until=")); err != nil {
+				return interval, nil, nil, err
+			}
+		default:
+			return interval, condition, args, nil
+		}
+		args = args[1:]
+	}
+	return interval, condition, args, nil
+}
+
+// watchItems returns the resources in an API response, a response which does
+// not list any resources is returned as a single item
+func watchItems(response map[string]interface{}) []map[string]interface{} {
+	var listed []interface{}
+	scalar := false
+	for key, value := range response {
+		if key == "count" || value == nil {
+			continue
+		}
+		items, _, ok := getItemsFromValue(value)
+		if !ok {
+			scalar = true
+			continue
+		}
+		if listed == nil || len(items) > len(listed) {
+			listed = items
+		}
+	}
+	if listed == nil && scalar {
+		return []map[string]interface{}{response}
+	}
+	var resources []map[string]interface{}
+	for _, item := range listed {
+		if resource, ok := item.(map[string]interface{}); ok {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func watchColumns(items []map[string]interface{}, filter []string, exclude []string) []string {
+	if len(filter) > 0 {
+		return filter
+	}
+	excluded := make(map[string]bool)
+	for _, key := range exclude {
+		excluded[key] = true
+	}
+	seen := make(map[string]bool)
+	var columns []string
+	for _, item := range items {
+		for key := range item {
+			if !seen[key] && !excluded[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// renderWatch renders resources as a table, highlighting rows added and cells
+// changed since the previous snapshot, and returns the new snapshot
+func renderWatch(w io.Writer, items []map[string]interface{}, columns []string, previous watchSnapshot, color bool) watchSnapshot {
+	snapshot := make(watchSnapshot)
+	if len(items) == 0 {
+		fmt.Fprintln(w, "No resources listed")
+	} else {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader(columns)
+		for idx, item := range items {
+			rowKey := fmt.Sprintf("#%d", idx)
+			if id, ok := item["id"]; ok {
+				rowKey = fmt.Sprint(id)
+			}
+			cells := make(map[string]string)
+			previousCells, seen := previous[rowKey]
+			row := make([]string, len(columns))
+			colors := make([]tablewriter.Colors, len(columns))
+			for col, column := range columns {
+				cells[column] = jsonify(item[column], "table")
+				row[col] = cells[column]
+				switch {
+				case previous != nil && !seen:
+					colors[col] = watchAddedColors
+				case seen && previousCells[column] != cells[column]:
+					colors[col] = watchChangedColors
+					if !color {
+						row[col] = "*" + row[col]
+					}
+				}
+			}
+			snapshot[rowKey] = cells
+			if color {
+				table.Rich(row, colors)
+			} else {
+				table.Append(row)
+			}
+		}
+		table.Render()
+	}
+
+	var removed []string
+	for rowKey := range previous {
+		if _, found := snapshot[rowKey]; !found {
+			removed = append(removed, rowKey)
+		}
+	}
+	if len(removed) > 0 {
+		sort.Strings(removed)
+		message := "Removed: " + strings.Join(removed, ", ")
+		if color {
+			message = fmt.Sprintf("\033[%dm%s\033[0m", tablewriter.FgRedColor, message)
+		}
+		fmt.Fprintln(w, message)
+	}
+	return snapshot
+}
+
+func init() {
+	AddCommand(&Command{
+		Name:  "watch",
+		Help:  "Re-runs an API periodically and highlights changes",
+		Usage: watchUsage,
+		Handle: func(r *Request) error {
+			interval, condition, args, err := parseWatchOptions(r.Args)
+			if err != nil {
+				return newCommandError(ExitUsage, err)
+			}
+			if len(args) == 0 {
+				fmt.Println(watchUsage)
+				return nil
+			}
+			apiName, apiArgs := findAPI(r, args)
+			api := r.Config.GetCache()[apiName]
+			if api == nil {
+				return newCommandError(ExitUsage, errors.New("unknown command or API requested"))
+			}
+			if apiArgs, err = expandParamsArg(r, api, apiArgs); err != nil {
+				return err
+			}
+			if err := checkArgs(r, api, apiArgs); err != nil {
+				return err
+			}
+			filter := outputKeys(apiArgs, "filter=")
+			exclude := outputKeys(apiArgs, "exclude=")
+			terminal := isTerminal(os.Stdout)
+
+			ctx := requestContext(r)
+			var previous watchSnapshot
+			for {
+				response, err := apiRequest(ctx, r, api.Name, apiArgs, api.Async)
+				if ctx.Err() != nil {
+					break
+				}
+
+				var output bytes.Buffer
+				fmt.Fprintf(&output, "Every %s: %s\t%s\n\n", interval, strings.Join(args, " "), time.Now().Format(time.RFC1123))
+				done := false
+				if err != nil {
+					if code := ExitCode(err); code == ExitUsage || code == ExitMissingParams || code == ExitAuth {
+						return err
+					}
+					fmt.Fprintln(&output, "🙈 Error:", err)
+				} else {
+					items := watchItems(response)
+					previous = renderWatch(&output, items, watchColumns(items, filter, exclude), previous, terminal)
+					done = condition != nil && condition.met(items)
+				}
+				if terminal {
+					fmt.Print(clearScreen)
+				}
+				fmt.Print(output.String())
+				if done {
+					fmt.Println("Watch condition met, stopped watching")
+					return nil
+				}
+
+				timer := time.NewTimer(interval)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+				case <-timer.C:
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			}
+			if r.Config.HasShell {
+				return nil
+			}
+			return ctx.Err()
+		},
+	})
+}
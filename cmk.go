@@ -26,6 +26,7 @@ import (
 	"github.com/apache/cloudstack-cloudmonkey/cli"
 	"github.com/apache/cloudstack-cloudmonkey/cmd"
 	"github.com/apache/cloudstack-cloudmonkey/config"
+	"github.com/apache/cloudstack-cloudmonkey/mock"
 )
 
 // GitSHA holds the git SHA
@@ -50,6 +51,10 @@ func main() {
 	acsURL := flag.String("u", config.DefaultACSAPIEndpoint, "cloudStack's API endpoint URL")
 	apiKey := flag.String("k", "", "cloudStack user's API Key")
 	secretKey := flag.String("s", "", "cloudStack user's secret Key")
+	mockServer := flag.Bool("mock", false, "use an in-process mock management server")
+	recordFile := flag.String("record", "", "record API traffic to a file")
+	replayFile := flag.String("replay", "", "replay API traffic from a recorded file")
+	traceFile := flag.String("trace", "", "trace API request timings to a HAR file, or - for a summary only")
 	flag.Parse()
 	args := flag.Args()
 
@@ -67,7 +72,7 @@ func main() {
 	if *outputFormat != "" {
 		if !config.CheckIfValuePresent(config.GetOutputFormats(), *outputFormat) {
 			fmt.Println("Invalid value set for output format. Supported values: " + validFormats)
-			os.Exit(1)
+			os.Exit(cmd.ExitUsage)
 		}
 		cfg.UpdateConfig("output", *outputFormat, false)
 	}
@@ -87,16 +92,62 @@ func main() {
 	if *profile != "" {
 		cfg.LoadProfile(*profile)
 	}
+
+	// exit closes the mock server, which deferred calls would not do on os.Exit
+	var server *mock.Server
+	exit := func(code int) {
+		if server != nil {
+			server.Close()
+		}
+		os.Exit(code)
+	}
+
+	if *mockServer {
+		server = mock.NewServer()
+		cfg.UpdateConfig("url", server.APIURL(), false)
+		cfg.UpdateConfig("apikey", server.APIKey, false)
+		cfg.UpdateConfig("secretkey", server.SecretKey, false)
+		fmt.Fprintln(os.Stderr, "Using mock management server:", server.APIURL())
+	}
+
+	if *recordFile != "" {
+		cfg.UpdateConfig("record", *recordFile, false)
+	}
+
+	if *replayFile != "" {
+		if err := cfg.LoadReplay(*replayFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to set up API traffic replay:", err)
+			exit(cmd.ExitUsage)
+		}
+	}
+
+	if *traceFile != "" {
+		cfg.UpdateConfig("trace", *traceFile, false)
+	}
 	config.LoadCache(cfg)
 	cli.SetConfig(cfg)
 
 	config.Debug("cmdline args:", strings.Join(os.Args, ", "))
 	if len(args) > 0 {
-		if err := cli.ExecCmd(args, (*apiKey != "" || *secretKey != "")); err != nil {
-			fmt.Println("🙈 Error:", err)
-			os.Exit(1)
+		if !config.CheckIfValuePresent([]string{"sync", "set", "help", "version"}, args[0]) {
+			cmd.AutoSync(cmd.NewRequest(nil, cfg, nil, (*apiKey != "" || *secretKey != "")), os.Stderr, false)
 		}
-		os.Exit(0)
+		err := cli.ExecCmd(args, (*apiKey != "" || *secretKey != ""))
+		if *traceFile != "" {
+			cmd.PrintTraceSummary(os.Stderr, cfg.TraceEntries())
+		}
+		if err := cfg.FlushTrace(); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write the trace file:", err)
+		}
+		if err != nil {
+			cmd.PrintError(cfg.Core.Output, err)
+			exit(cmd.ExitCode(err))
+		}
+		exit(cmd.ExitOK)
 	}
 	cli.ExecPrompt()
+	if err := cfg.FlushTrace(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write the trace file:", err)
+	}
+	exit(cmd.ExitOK)
 }
@@ -19,6 +19,9 @@ package config
 
 import "fmt"
 
+// version of the CLI
+const version = "6.5.0-rc"
+
 // Name of the CLI
 func (c *Config) Name() string {
 	return "Apache CloudStack 🐵 CloudMonkey"
@@ -26,7 +29,7 @@ func (c *Config) Name() string {
 
 // Version CLI
 func (c *Config) Version() string {
-	return "6.5.0-rc"
+	return version
 }
 
 // PrintHeader prints startup message in CLI mode
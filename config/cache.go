@@ -20,11 +20,14 @@ package config
 import (
 	_ "embed" // for embedding apis.json
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
@@ -32,6 +35,7 @@ import (
 const (
 	FAKE        = "fake"
 	FilePathArg = "filepath="
+	TimeoutArg  = "timeout="
 )
 
 //go:embed apis.json
@@ -45,6 +49,15 @@ type APIArg struct {
 	Description string
 	Required    bool
 	Length      int
+	Since       string
+}
+
+// APIResponse is a field of the response of an API, the fields of nested
+// objects are named parent.field
+type APIResponse struct {
+	Name        string
+	Type        string
+	Description string
 }
 
 // API describes a CloudStack API
@@ -58,14 +71,41 @@ type API struct {
 	Related      []string
 	Async        bool
 	Description  string
+	Since        string
 	ResponseKeys []string
+	Response     []*APIResponse
+}
+
+// SyncInfo describes when and from which management server version the API
+// cache was discovered
+type SyncInfo struct {
+	ServerVersion string    `json:"serverversion"`
+	Synced        time.Time `json:"synced"`
+	APICount      int       `json:"apicount"`
 }
 
+// syncInfoKey is the key of the sync info stored in the API cache file
+const syncInfoKey = "syncinfo"
+
+// cacheLock guards the API cache, which is read by background completions
+// while it may be synced
+var cacheLock sync.RWMutex
 var apiCache map[string]*API
 var apiVerbMap map[string][]*API
+var cacheSyncInfo *SyncInfo
+
+// CacheSyncInfo returns the sync info of the loaded API cache, or nil if the
+// bundled API cache is used
+func (c *Config) CacheSyncInfo() *SyncInfo {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
+	return cacheSyncInfo
+}
 
 // GetAPIVerbMap returns API cache by verb
 func (c *Config) GetAPIVerbMap() map[string][]*API {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
 	if apiVerbMap != nil {
 		return apiVerbMap
 	}
@@ -77,8 +117,28 @@ func (c *Config) GetAPIVerbMap() map[string][]*API {
 	return apiSplitMap
 }
 
+// FindListAPI returns the list API for a plural noun, such as virtualmachines
+func FindListAPI(apiMap map[string][]*API, noun string) *API {
+	for _, listAPI := range apiMap["list"] {
+		if noun == listAPI.Noun {
+			return listAPI
+		}
+	}
+	return nil
+}
+
+// PluralNoun returns the plural form of a noun as used by list APIs
+func PluralNoun(noun string) string {
+	if strings.HasSuffix(noun, "s") || strings.HasSuffix(noun, "x") || strings.HasSuffix(noun, "z") || strings.HasSuffix(noun, "ch") || strings.HasSuffix(noun, "sh") {
+		return noun + "es"
+	}
+	return noun + "s"
+}
+
 // GetCache returns API cache by full API name
 func (c *Config) GetCache() map[string]*API {
+	cacheLock.RLock()
+	defer cacheLock.RUnlock()
 	if apiCache == nil {
 		// read from disk?
 		return make(map[string]*API)
@@ -86,43 +146,225 @@ func (c *Config) GetCache() map[string]*API {
 	return apiCache
 }
 
+// GetBundledAPICache returns the in-built API discovery data shipped with cmk
+func GetBundledAPICache() map[string]interface{} {
+	var data map[string]interface{}
+	_ = json.Unmarshal(bundledAPICache, &data)
+	return data
+}
+
 // LoadCache loads cache using the default cache file
 func LoadCache(c *Config) interface{} {
 	cacheFile := c.CacheFile()
 	Debug("Trying to read API cache from:", cacheFile)
 	cache, err := ioutil.ReadFile(cacheFile)
-	if err != nil {
+	var info *SyncInfo
+	if err == nil {
+		var data map[string]interface{}
+		if err = json.Unmarshal(cache, &data); err == nil {
+			var count interface{}
+			if count, err = c.UpdateCache(data); err == nil {
+				info = readSyncInfo(cacheFile, cache)
+				cacheLock.Lock()
+				cacheSyncInfo = info
+				cacheLock.Unlock()
+				return count
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Loaded in-built API cache. Failed to parse API cache, please run 'sync': %v\n", err)
+	} else {
 		fmt.Fprintf(os.Stderr, "Loaded in-built API cache. Failed to read API cache, please run 'sync'.\n")
-		cache = bundledAPICache
 	}
-	var data map[string]interface{}
-	_ = json.Unmarshal(cache, &data)
-	return c.UpdateCache(data)
+	cacheLock.Lock()
+	cacheSyncInfo = nil
+	cacheLock.Unlock()
+	count, _ := c.UpdateCache(GetBundledAPICache())
+	return count
 }
 
-// SaveCache saves received auto-discovery data to cache file
-func (c *Config) SaveCache(response map[string]interface{}) {
-	output, _ := json.Marshal(response)
+// readSyncInfo returns the sync info stored in an API cache file, caches saved
+// without it are considered synced when the file was last modified
+func readSyncInfo(cacheFile string, cache []byte) *SyncInfo {
+	var data struct {
+		SyncInfo *SyncInfo `json:"syncinfo"`
+	}
+	if err := json.Unmarshal(cache, &data); err == nil && data.SyncInfo != nil {
+		return data.SyncInfo
+	}
+	info := &SyncInfo{}
+	if fileInfo, err := os.Stat(cacheFile); err == nil {
+		info.Synced = fileInfo.ModTime()
+	}
+	return info
+}
+
+// SaveCache saves received auto-discovery data to cache file, along with the
+// version of the management server it was discovered from
+func (c *Config) SaveCache(response map[string]interface{}, serverVersion string) {
+	count := 0
+	if apiList, ok := response["api"].([]interface{}); ok {
+		count = len(apiList)
+	}
+	info := &SyncInfo{
+		ServerVersion: serverVersion,
+		Synced:        time.Now().UTC(),
+		APICount:      count,
+	}
+	cacheLock.Lock()
+	cacheSyncInfo = info
+	cacheLock.Unlock()
+	data := make(map[string]interface{}, len(response)+1)
+	for key, value := range response {
+		data[key] = value
+	}
+	data[syncInfoKey] = info
+	output, _ := json.Marshal(data)
 	ioutil.WriteFile(c.CacheFile(), output, 0600)
 }
 
-// UpdateCache uses auto-discovery data to update internal API cache
-func (c *Config) UpdateCache(response map[string]interface{}) interface{} {
-	apiCache = make(map[string]*API)
+// UpdateCache uses auto-discovery data to update internal API cache, which is
+// kept if the data is malformed
+func (c *Config) UpdateCache(response map[string]interface{}) (interface{}, error) {
+	cache, err := ParseAPICache(response)
+	if err != nil {
+		return nil, err
+	}
+	cacheLock.Lock()
+	apiCache = cache
 	apiVerbMap = nil
+	cacheLock.Unlock()
+	return response["count"], nil
+}
 
-	count := response["count"]
-	apiList := response["api"].([]interface{})
+// optionalString returns a string field of auto-discovery data, which may be
+// missing
+func optionalString(node map[string]interface{}, key string) (string, error) {
+	value, found := node[key]
+	if !found || value == nil {
+		return "", nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", key)
+	}
+	return text, nil
+}
 
-	for _, node := range apiList {
+// optionalBool returns a boolean field of auto-discovery data, which may be
+// missing
+func optionalBool(node map[string]interface{}, key string) (bool, error) {
+	value, found := node[key]
+	if !found || value == nil {
+		return false, nil
+	}
+	flag, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s is not a boolean", key)
+	}
+	return flag, nil
+}
+
+// optionalList returns a list field of auto-discovery data, which may be
+// missing
+func optionalList(node map[string]interface{}, key string) ([]interface{}, error) {
+	value, found := node[key]
+	if !found || value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a list", key)
+	}
+	return list, nil
+}
+
+// parseAPIArg returns the arg described by a param of auto-discovery data
+func parseAPIArg(node interface{}) (*APIArg, error) {
+	apiArg, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("param is not an object")
+	}
+	name, err := optionalString(apiArg, "name")
+	if err != nil {
+		return nil, fmt.Errorf("param %v", err)
+	}
+	if len(name) == 0 {
+		return nil, errors.New("param has no name")
+	}
+	argType, err := optionalString(apiArg, "type")
+	if err != nil {
+		return nil, fmt.Errorf("param %s: %v", name, err)
+	}
+	required, err := optionalBool(apiArg, "required")
+	if err != nil {
+		return nil, fmt.Errorf("param %s: %v", name, err)
+	}
+	description, err := optionalString(apiArg, "description")
+	if err != nil {
+		return nil, fmt.Errorf("param %s: %v", name, err)
+	}
+	relatedNames, err := optionalString(apiArg, "related")
+	if err != nil {
+		return nil, fmt.Errorf("param %s: %v", name, err)
+	}
+	related := []string{}
+	if apiArg["related"] != nil {
+		related = strings.Split(relatedNames, ",")
+		sort.Strings(related)
+	}
+	length := 0
+	if value, ok := apiArg["length"].(float64); ok {
+		length = int(value)
+	}
+	since, _ := apiArg["since"].(string)
+	return &APIArg{
+		Name:        name + "=",
+		Type:        argType,
+		Required:    required,
+		Related:     related,
+		Description: description,
+		Length:      length,
+		Since:       since,
+	}, nil
+}
+
+// ParseAPICache returns the APIs described by auto-discovery data, by lower
+// case API name, or an error if the data is malformed
+func ParseAPICache(response map[string]interface{}) (map[string]*API, error) {
+	cache := make(map[string]*API)
+	apiList, err := optionalList(response, "api")
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, node := range apiList {
 		api, valid := node.(map[string]interface{})
 		if !valid {
-			fmt.Println("Error, moving on...")
-			continue
+			return nil, fmt.Errorf("API %d is not an object", idx+1)
+		}
+		apiName, err := optionalString(api, "name")
+		if err == nil && len(apiName) == 0 {
+			err = errors.New("name is missing")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("API %d: %v", idx+1, err)
+		}
+		isAsync, err := optionalBool(api, "isasync")
+		if err != nil {
+			return nil, fmt.Errorf("API %s: %v", apiName, err)
+		}
+		description, err := optionalString(api, "description")
+		if err != nil {
+			return nil, fmt.Errorf("API %s: %v", apiName, err)
+		}
+		params, err := optionalList(api, "params")
+		if err != nil {
+			return nil, fmt.Errorf("API %s: %v", apiName, err)
+		}
+		responseNodes, err := optionalList(api, "response")
+		if err != nil {
+			return nil, fmt.Errorf("API %s: %v", apiName, err)
 		}
-		apiName := api["name"].(string)
-		isAsync := api["isasync"].(bool)
-		description := api["description"].(string)
 
 		idx := 0
 		for _, chr := range apiName {
@@ -136,20 +378,12 @@ func (c *Config) UpdateCache(response map[string]interface{}) interface{} {
 		noun := strings.ToLower(apiName[idx:])
 
 		var apiArgs []*APIArg
-		for _, argNode := range api["params"].([]interface{}) {
-			apiArg, _ := argNode.(map[string]interface{})
-			related := []string{}
-			if apiArg["related"] != nil {
-				related = strings.Split(apiArg["related"].(string), ",")
-				sort.Strings(related)
+		for _, argNode := range params {
+			apiArg, err := parseAPIArg(argNode)
+			if err != nil {
+				return nil, fmt.Errorf("API %s: %v", apiName, err)
 			}
-			apiArgs = append(apiArgs, &APIArg{
-				Name:        apiArg["name"].(string) + "=",
-				Type:        apiArg["type"].(string),
-				Required:    apiArg["required"].(bool),
-				Related:     related,
-				Description: apiArg["description"].(string),
-			})
+			apiArgs = append(apiArgs, apiArg)
 		}
 
 		// Add filter arg
@@ -180,12 +414,22 @@ func (c *Config) UpdateCache(response map[string]interface{}) interface{} {
 			fakeArgs = append(fakeArgs, fakeArg.Name)
 		}
 
+		if isAsync && !hasArg(apiArgs, TimeoutArg) {
+			fakeArg = &APIArg{
+				Name:        TimeoutArg,
+				Type:        FAKE,
+				Description: "cloudmonkey specific async job polling timeout in seconds, overrides the timeout setting",
+			}
+			apiArgs = append(apiArgs, fakeArg)
+			fakeArgs = append(fakeArgs, fakeArg.Name)
+		}
+
 		sort.Slice(apiArgs, func(i, j int) bool {
 			return apiArgs[i].Name < apiArgs[j].Name
 		})
 
 		var responseKeys []string
-		for _, respNode := range api["response"].([]interface{}) {
+		for _, respNode := range responseNodes {
 			if resp, ok := respNode.(map[string]interface{}); ok {
 				if resp == nil || resp["name"] == nil {
 					continue
@@ -202,7 +446,10 @@ func (c *Config) UpdateCache(response map[string]interface{}) interface{} {
 			}
 		}
 
-		apiCache[strings.ToLower(apiName)] = &API{
+		relatedAPIs := relatedAPINames(apiName, api["related"], apiArgs)
+		since, _ := api["since"].(string)
+
+		cache[strings.ToLower(apiName)] = &API{
 			Name:         apiName,
 			Verb:         verb,
 			Noun:         noun,
@@ -210,11 +457,75 @@ func (c *Config) UpdateCache(response map[string]interface{}) interface{} {
 			RequiredArgs: requiredArgs,
 			FakeArgs:     fakeArgs,
 			Async:        isAsync,
+			Related:      relatedAPIs,
 			Description:  description,
+			Since:        since,
 			ResponseKeys: responseKeys,
+			Response:     parseAPIResponse("", responseNodes),
 		}
 	}
-	return count
+	return cache, nil
+}
+
+// relatedAPINames returns the sorted names of the APIs related to an API, and of
+// the APIs related to its args
+func relatedAPINames(apiName string, related interface{}, args []*APIArg) []string {
+	seen := map[string]bool{apiName: true, "": true}
+	var names []string
+	add := func(name string) {
+		if name = strings.TrimSpace(name); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if value, ok := related.(string); ok {
+		for _, name := range strings.Split(value, ",") {
+			add(name)
+		}
+	}
+	for _, arg := range args {
+		for _, name := range arg.Related {
+			add(name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseAPIResponse returns the response fields of an API, including the fields
+// of nested objects
+func parseAPIResponse(prefix string, response interface{}) []*APIResponse {
+	nodes, _ := response.([]interface{})
+	var fields []*APIResponse
+	for _, node := range nodes {
+		field, ok := node.(map[string]interface{})
+		if !ok || field["name"] == nil {
+			continue
+		}
+		name := prefix + fmt.Sprint(field["name"])
+		fieldType, _ := field["type"].(string)
+		description, _ := field["description"].(string)
+		fields = append(fields, &APIResponse{Name: name, Type: fieldType, Description: description})
+		fields = append(fields, parseAPIResponse(name+".", field["response"])...)
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// HasArg returns true if the API accepts an arg, provided as name=
+func (api *API) HasArg(name string) bool {
+	return hasArg(api.Args, name)
+}
+
+func hasArg(args []*APIArg, name string) bool {
+	for _, arg := range args {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // IsFileUploadAPI checks if the provided API name corresponds to a file upload-related API.
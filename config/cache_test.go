@@ -0,0 +1,54 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAPICache(t *testing.T) {
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{`{"api": [{"name": "listZones", "isasync": false, "params": [{"name": "id", "type": "uuid"}]}]}`, true},
+		{`{"count": 0}`, true},
+		{`{"api": {"name": "listZones"}}`, false},
+		{`{"api": ["listZones"]}`, false},
+		{`{"api": [{"isasync": false}]}`, false},
+		{`{"api": [{"name": 1}]}`, false},
+		{`{"api": [{"name": "listZones", "isasync": "false"}]}`, false},
+		{`{"api": [{"name": "listZones", "params": {"name": "id"}}]}`, false},
+		{`{"api": [{"name": "listZones", "params": [{"type": "uuid"}]}]}`, false},
+		{`{"api": [{"name": "listZones", "response": [1]}]}`, true},
+	}
+	for _, test := range tests {
+		var response map[string]interface{}
+		if err := json.Unmarshal([]byte(test.content), &response); err != nil {
+			t.Fatalf("invalid test data %s: %v", test.content, err)
+		}
+		apis, err := ParseAPICache(response)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseAPICache(%s) = %v, expected valid %v", test.content, err, test.valid)
+		}
+		if err == nil && len(apis) > 0 && apis["listzones"] == nil {
+			t.Errorf("expected listZones to be parsed from %s", test.content)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CompletionOption is a value offered when autocompleting an API arg
+type CompletionOption struct {
+	Value  string `json:"value"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type completionEntry struct {
+	Noun    string             `json:"noun"`
+	Options []CompletionOption `json:"options"`
+	Fetched time.Time          `json:"fetched"`
+}
+
+// CompletionCache holds the autocompletion options of a server profile, keyed
+// by the list API and args used to fetch them
+type CompletionCache struct {
+	mu         sync.Mutex
+	profile    string
+	file       string
+	entries    map[string]*completionEntry
+	refreshing map[string]bool
+}
+
+func newCompletionCache(profile string, file string) *CompletionCache {
+	cache := &CompletionCache{
+		profile:    profile,
+		file:       file,
+		entries:    make(map[string]*completionEntry),
+		refreshing: make(map[string]bool),
+	}
+	if file == "" {
+		return cache
+	}
+	if data, err := os.ReadFile(file); err == nil {
+		if err := json.Unmarshal(data, &cache.entries); err != nil {
+			Debug("Failed to read completion cache file:", err)
+			cache.entries = make(map[string]*completionEntry)
+		}
+	}
+	return cache
+}
+
+// CompletionCache returns the autocompletion cache of the active server profile
+func (c *Config) CompletionCache() *CompletionCache {
+	c.completionLock.Lock()
+	defer c.completionLock.Unlock()
+	profile := ""
+	if c.Core != nil {
+		profile = c.Core.ProfileName
+	}
+	if c.completions == nil || c.completions.profile != profile {
+		file := ""
+		if c.Core != nil && c.Core.CompletionDisk {
+			file = path.Join(c.Dir, "profiles", profile+".completions")
+		}
+		c.completions = newCompletionCache(profile, file)
+	}
+	return c.completions
+}
+
+// InvalidateCompletions drops cached autocompletion options after an API which
+// may have changed resources of a noun, such as deployVirtualMachine
+func (c *Config) InvalidateCompletions(noun string) {
+	c.completionLock.Lock()
+	cache := c.completions
+	c.completionLock.Unlock()
+	if cache == nil || noun == "" {
+		return
+	}
+	cache.Invalidate(noun)
+}
+
+// Get returns the cached options for a key, and whether they were fetched
+// within the ttl
+func (cc *CompletionCache) Get(key string, ttl time.Duration) ([]CompletionOption, bool, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	entry, found := cc.entries[key]
+	if !found {
+		return nil, false, false
+	}
+	return entry.Options, time.Since(entry.Fetched) < ttl, true
+}
+
+// Put caches the options fetched for a key from a list API of a noun
+func (cc *CompletionCache) Put(key string, noun string, options []CompletionOption) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.entries[key] = &completionEntry{Noun: strings.ToLower(noun), Options: options, Fetched: time.Now()}
+	delete(cc.refreshing, key)
+	cc.save()
+}
+
+// StartRefresh marks a key as being refreshed, it returns false if a refresh
+// of the key is already running
+func (cc *CompletionCache) StartRefresh(key string) bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.refreshing[key] {
+		return false
+	}
+	cc.refreshing[key] = true
+	return true
+}
+
+// FinishRefresh clears the refreshing mark of a key whose refresh failed
+func (cc *CompletionCache) FinishRefresh(key string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	delete(cc.refreshing, key)
+}
+
+// Invalidate drops the options fetched from list APIs of a noun, the noun may
+// be singular or plural
+func (cc *CompletionCache) Invalidate(noun string) {
+	noun = strings.ToLower(noun)
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	changed := false
+	for key, entry := range cc.entries {
+		if entry.Noun == noun || entry.Noun == PluralNoun(noun) || PluralNoun(entry.Noun) == noun {
+			delete(cc.entries, key)
+			changed = true
+		}
+	}
+	if changed {
+		Debug("Invalidated completion cache for", noun)
+		cc.save()
+	}
+}
+
+func (cc *CompletionCache) save() {
+	if cc.file == "" {
+		return
+	}
+	data, err := json.Marshal(cc.entries)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(cc.file, data, 0600); err != nil {
+		Debug("Failed to write completion cache file:", err)
+	}
+}
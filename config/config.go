@@ -28,6 +28,8 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/briandowns/spinner"
@@ -47,10 +49,13 @@ const (
 )
 
 var nonEmptyConfigKeys = map[string]bool{
-	"output":  true,
-	"timeout": true,
-	"profile": true,
-	"url":     true,
+	"output":          true,
+	"timeout":         true,
+	"profile":         true,
+	"url":             true,
+	"pollinterval":    true,
+	"pollbackoff":     true,
+	"pollmaxinterval": true,
 }
 
 // DefaultACSAPIEndpoint is the default API endpoint for CloudStack.
@@ -58,25 +63,40 @@ const DefaultACSAPIEndpoint = "http://localhost:8080/client/api"
 
 // ServerProfile describes a management server
 type ServerProfile struct {
-	URL       string       `ini:"url"`
-	Username  string       `ini:"username"`
-	Password  string       `ini:"password"`
-	Domain    string       `ini:"domain"`
-	APIKey    string       `ini:"apikey"`
-	SecretKey string       `ini:"secretkey"`
-	Client    *http.Client `ini:"-"`
+	URL         string       `ini:"url"`
+	Username    string       `ini:"username"`
+	Password    string       `ini:"password"`
+	Domain      string       `ini:"domain"`
+	APIKey      string       `ini:"apikey"`
+	SecretKey   string       `ini:"secretkey"`
+	RateLimit   float64      `ini:"ratelimit"`
+	RateBurst   int          `ini:"rateburst"`
+	MaxInFlight int          `ini:"maxinflight"`
+	Client      *http.Client `ini:"-"`
+
+	limits *requestLimits
 }
 
 // Core block describes common options for the CLI
 type Core struct {
-	Prompt       string `ini:"prompt"`
-	AsyncBlock   bool   `ini:"asyncblock"`
-	Timeout      int    `ini:"timeout"`
-	Output       string `ini:"output"`
-	VerifyCert   bool   `ini:"verifycert"`
-	ProfileName  string `ini:"profile"`
-	AutoComplete bool   `ini:"autocomplete"`
-	PostRequest  bool   `ini:"postrequest"`
+	Prompt            string  `ini:"prompt"`
+	AsyncBlock        bool    `ini:"asyncblock"`
+	Timeout           int     `ini:"timeout"`
+	Output            string  `ini:"output"`
+	VerifyCert        bool    `ini:"verifycert"`
+	ProfileName       string  `ini:"profile"`
+	AutoComplete      bool    `ini:"autocomplete"`
+	PostRequest       bool    `ini:"postrequest"`
+	PollInterval      int     `ini:"pollinterval"`
+	PollBackoff       float64 `ini:"pollbackoff"`
+	PollMaxInterval   int     `ini:"pollmaxinterval"`
+	DetachOnInterrupt bool    `ini:"detachoninterrupt"`
+	CompletionTTL     int     `ini:"completionttl"`
+	CompletionDisk    bool    `ini:"completiondisk"`
+	Completion        string  `ini:"completion"`
+	Strict            bool    `ini:"strict"`
+	AutoSync          string  `ini:"autosync"`
+	SyncMaxAge        int     `ini:"syncmaxage"`
 }
 
 // Config describes CLI config file and default options
@@ -90,8 +110,14 @@ type Config struct {
 	ActiveProfile  *ServerProfile
 	Context        *context.Context
 	Cancel         context.CancelFunc
-	C              chan bool
+	RecordFile     string
+	ReplayFile     string
+	TraceFile      string
+	tracer         *httpTracer
+	spinnerLock    sync.Mutex
 	activeSpinners []*spinner.Spinner
+	completionLock sync.Mutex
+	completions    *CompletionCache
 }
 
 // GetOutputFormats returns the supported output formats.
@@ -110,16 +136,40 @@ func CheckIfValuePresent(dataset []string, element string) bool {
 }
 
 // CacheFile returns the path to the cache file for a server profile
-func (c Config) CacheFile() string {
+func (c *Config) CacheFile() string {
+	profile := ""
+	if c.Core != nil {
+		profile = c.Core.ProfileName
+	}
+	return c.ProfileCacheFile(profile)
+}
+
+// ProfileCacheFile returns the path to the cache file of a named server profile
+func (c *Config) ProfileCacheFile(profile string) string {
 	cacheDir := path.Join(c.Dir, "profiles")
 	cacheFileName := "cache"
-	if c.Core != nil && len(c.Core.ProfileName) > 0 {
-		cacheFileName = c.Core.ProfileName + ".cache"
+	if len(profile) > 0 {
+		cacheFileName = profile + ".cache"
 	}
 	checkAndCreateDir(cacheDir)
 	return path.Join(cacheDir, cacheFileName)
 }
 
+// ExamplesFile returns the path to the file of user provided usage examples
+// of an API, kept in the examples directory next to the API cache files
+func (c *Config) ExamplesFile(apiName string) string {
+	return path.Join(c.Dir, "profiles", "examples", strings.ToLower(apiName)+".txt")
+}
+
+// APIExamples returns the user provided usage examples of an API
+func (c *Config) APIExamples(apiName string) string {
+	examples, err := os.ReadFile(c.ExamplesFile(apiName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(examples))
+}
+
 func hasAccess(path string) bool {
 	status := true
 	file, err := os.Open(path)
@@ -157,14 +207,24 @@ func getDefaultConfigDir() string {
 
 func defaultCoreConfig() Core {
 	return Core{
-		Prompt:       "🐱",
-		AsyncBlock:   true,
-		Timeout:      1800,
-		Output:       JSON,
-		VerifyCert:   true,
-		ProfileName:  "localcloud",
-		AutoComplete: true,
-		PostRequest:  true,
+		Prompt:            "🐱",
+		AsyncBlock:        true,
+		Timeout:           1800,
+		Output:            JSON,
+		VerifyCert:        true,
+		ProfileName:       "localcloud",
+		AutoComplete:      true,
+		PostRequest:       true,
+		PollInterval:      2,
+		PollBackoff:       1,
+		PollMaxInterval:   30,
+		DetachOnInterrupt: false,
+		CompletionTTL:     300,
+		CompletionDisk:    false,
+		Completion:        "prefix",
+		Strict:            false,
+		AutoSync:          "prompt",
+		SyncMaxAge:        30,
 	}
 }
 
@@ -201,30 +261,54 @@ func GetProfiles() []string {
 	return profiles
 }
 
-// SetupContext initializes the context and signal handling for the config.
+var (
+	signalOnce    sync.Once
+	interruptLock sync.Mutex
+	// interrupt cancels the context set up last, on interrupt
+	interrupt context.CancelFunc
+)
+
+// SetupContext initializes the context of the config, which is cancelled on
+// interrupt. Interrupts are handled by a single goroutine for all contexts.
 func SetupContext(cfg *Config) {
-	cfg.C = make(chan bool)
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
+	signalOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		go func() {
+			for range signals {
+				interruptLock.Lock()
+				if interrupt != nil {
+					interrupt()
+				}
+				interruptLock.Unlock()
+			}
+		}()
+	})
 	ctx, cancel := context.WithCancel(context.Background())
+	interruptLock.Lock()
+	interrupt = cancel
+	interruptLock.Unlock()
 	cfg.Context = &ctx
 	cfg.Cancel = cancel
-	go func() {
-		<-signals
-		cfg.Cancel()
-		cfg.C <- true
-	}()
+}
+
+func newHTTPTransport(cfg *Config) http.RoundTripper {
+	transport, err := newTrafficTransport(cfg, newRateLimitTransport(cfg.ActiveProfile, newTracingTransport(cfg, &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: !cfg.Core.VerifyCert},
+	})))
+	if err != nil {
+		fmt.Println("Error caught while setting up API traffic replay:", err)
+	}
+	return transport
 }
 
 func newHTTPClient(cfg *Config) *http.Client {
 	SetupContext(cfg)
 	jar, _ := cookiejar.New(nil)
 	client := &http.Client{
-		Jar: jar,
-		Transport: &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: !cfg.Core.VerifyCert},
-		},
+		Jar:       jar,
+		Transport: newHTTPTransport(cfg),
 	}
 	client.Timeout = time.Duration(time.Duration(cfg.Core.Timeout) * time.Second)
 	return client
@@ -301,6 +385,20 @@ func saveConfig(cfg *Config) *Config {
 		if !conf.Section(ini.DEFAULT_SECTION).HasKey("postrequest") {
 			core.PostRequest = true
 		}
+		if !conf.Section(ini.DEFAULT_SECTION).HasKey("pollinterval") {
+			defaultCore := defaultCoreConfig()
+			core.PollInterval = defaultCore.PollInterval
+			core.PollBackoff = defaultCore.PollBackoff
+			core.PollMaxInterval = defaultCore.PollMaxInterval
+		}
+		if !conf.Section(ini.DEFAULT_SECTION).HasKey("completionttl") {
+			core.CompletionTTL = defaultCoreConfig().CompletionTTL
+		}
+		if !conf.Section(ini.DEFAULT_SECTION).HasKey("autosync") {
+			defaultCore := defaultCoreConfig()
+			core.AutoSync = defaultCore.AutoSync
+			core.SyncMaxAge = defaultCore.SyncMaxAge
+		}
 		cfg.Core = core
 	}
 
@@ -403,6 +501,100 @@ func (c *Config) UpdateConfig(key string, value string, update bool) {
 		c.Core.AutoComplete = value == "true"
 	case "postrequest":
 		c.Core.PostRequest = value == "true"
+	case "pollinterval":
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 1 {
+			fmt.Println("Error caught while setting pollinterval, a positive number of seconds is required")
+			return
+		}
+		c.Core.PollInterval = intValue
+	case "pollbackoff":
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil || floatValue < 1 {
+			fmt.Println("Error caught while setting pollbackoff, a multiplier of at least 1 is required")
+			return
+		}
+		c.Core.PollBackoff = floatValue
+	case "pollmaxinterval":
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 1 {
+			fmt.Println("Error caught while setting pollmaxinterval, a positive number of seconds is required")
+			return
+		}
+		c.Core.PollMaxInterval = intValue
+	case "detachoninterrupt":
+		c.Core.DetachOnInterrupt = value == "true"
+	case "completionttl":
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			fmt.Println("Error caught while setting completionttl, a number of seconds is required, 0 disables caching")
+			return
+		}
+		c.Core.CompletionTTL = intValue
+	case "autosync":
+		if value != "auto" && value != "prompt" && value != "off" {
+			fmt.Println("Error caught while setting autosync, auto, prompt or off is required")
+			return
+		}
+		c.Core.AutoSync = value
+	case "syncmaxage":
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			fmt.Println("Error caught while setting syncmaxage, a number of days is required, 0 disables the age check")
+			return
+		}
+		c.Core.SyncMaxAge = intValue
+	case "strict":
+		c.Core.Strict = value == "true"
+	case "completion":
+		if value != "fuzzy" && value != "prefix" {
+			fmt.Println("Error caught while setting completion, fuzzy or prefix is required")
+			return
+		}
+		c.Core.Completion = value
+	case "completiondisk":
+		c.Core.CompletionDisk = value == "true"
+		c.completionLock.Lock()
+		c.completions = nil
+		c.completionLock.Unlock()
+	case "ratelimit":
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil || floatValue < 0 {
+			fmt.Println("Error caught while setting ratelimit, a number of requests per second is required, 0 disables rate limiting")
+			return
+		}
+		c.ActiveProfile.RateLimit = floatValue
+		c.ActiveProfile.Client.Transport = newHTTPTransport(c)
+	case "rateburst":
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			fmt.Println("Error caught while setting rateburst, a number of requests is required")
+			return
+		}
+		c.ActiveProfile.RateBurst = intValue
+		c.ActiveProfile.Client.Transport = newHTTPTransport(c)
+	case "maxinflight":
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			fmt.Println("Error caught while setting maxinflight, a number of requests is required, 0 disables the limit")
+			return
+		}
+		c.ActiveProfile.MaxInFlight = intValue
+		c.ActiveProfile.Client.Transport = newHTTPTransport(c)
+	case "record":
+		c.RecordFile = value
+		c.ActiveProfile.Client.Transport = newHTTPTransport(c)
+	case "replay":
+		if err := c.LoadReplay(value); err != nil {
+			fmt.Println("Error caught while setting replay,", err)
+			return
+		}
+	case "trace":
+		if err := c.FlushTrace(); err != nil {
+			fmt.Println("Failed to write the trace file:", err)
+		}
+		c.TraceFile = value
+		c.ActiveProfile.Client.Transport = newHTTPTransport(c)
 	default:
 		fmt.Println("Invalid option provided:", key)
 		return
@@ -0,0 +1,256 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxThrottledRetries is the number of times a throttled request is retried
+	maxThrottledRetries = 3
+	// defaultRetryAfter is the wait after a throttled response without Retry-After
+	defaultRetryAfter = time.Second
+	// maxRetryAfter is the longest wait asked for by a server that is honoured
+	maxRetryAfter = time.Minute
+)
+
+// rateLimiter is a token bucket which also pauses all requests after the
+// server asks to retry later
+type rateLimiter struct {
+	mu           sync.Mutex
+	rate         float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// setRate changes the rate and burst of a limiter, keeping its tokens
+func (l *rateLimiter) setRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	l.rate = rate
+	l.burst = float64(burst)
+	l.tokens = math.Min(l.burst, l.tokens)
+}
+
+// reserve takes a token if one is available, or returns how long to wait
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// wait blocks until a request may be sent or the context is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		Debug("Rate limiting API request for", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// pause blocks all requests for a duration
+func (l *rateLimiter) pause(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(delay); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// requestLimits are the rate limiter and in-flight slots of a server profile,
+// which are kept when the HTTP transport of the profile is rebuilt
+type requestLimits struct {
+	limiter  *rateLimiter
+	inFlight chan struct{}
+}
+
+// profileLimits returns the request limits of a profile, updated to its
+// current settings
+func profileLimits(profile *ServerProfile) *requestLimits {
+	limits := profile.limits
+	if limits == nil {
+		limits = &requestLimits{limiter: newRateLimiter(profile.RateLimit, profile.RateBurst)}
+		profile.limits = limits
+	} else {
+		limits.limiter.setRate(profile.RateLimit, profile.RateBurst)
+	}
+	if cap(limits.inFlight) != profile.MaxInFlight {
+		limits.inFlight = nil
+		if profile.MaxInFlight > 0 {
+			limits.inFlight = make(chan struct{}, profile.MaxInFlight)
+		}
+	}
+	return limits
+}
+
+// rateLimitTransport limits the rate and number of concurrent requests sent to
+// a management server, and retries throttled requests after the delay asked
+// for by the server
+type rateLimitTransport struct {
+	base     http.RoundTripper
+	limiter  *rateLimiter
+	inFlight chan struct{}
+}
+
+func newRateLimitTransport(profile *ServerProfile, base http.RoundTripper) http.RoundTripper {
+	if profile == nil {
+		return base
+	}
+	limits := profileLimits(profile)
+	return &rateLimitTransport{
+		base:     base,
+		limiter:  limits.limiter,
+		inFlight: limits.inFlight,
+	}
+}
+
+// RateLimitTransport returns a transport that shares the request limits of the
+// active server profile, for requests not sent by the profile's HTTP client
+func (c *Config) RateLimitTransport(base http.RoundTripper) http.RoundTripper {
+	return newRateLimitTransport(c.ActiveProfile, base)
+}
+
+// retryAfter returns the delay asked for by a throttled response, at most
+// maxRetryAfter
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if resp.StatusCode != http.StatusTooManyRequests && (value == "" || resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	delay := defaultRetryAfter
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	} else if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// releasingBody releases the in-flight slot of a response once it is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func (t *rateLimitTransport) send(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := t.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	if t.inFlight != nil {
+		select {
+		case t.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if t.inFlight == nil {
+		return resp, err
+	}
+	release := func() { <-t.inFlight }
+	if err != nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.send(req)
+		if err != nil || attempt >= maxThrottledRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		delay, throttled := retryAfter(resp)
+		if !throttled {
+			return resp, nil
+		}
+		Debug("API request throttled by the server, retrying after", delay)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		t.limiter.pause(delay)
+
+		retry := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		req = retry
+	}
+}
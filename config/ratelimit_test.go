@@ -0,0 +1,147 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is a transport calling a func for each request
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func testResponse(status int, retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("{}"))}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		delay      time.Duration
+		throttled  bool
+	}{
+		{http.StatusOK, "", 0, false},
+		{http.StatusTooManyRequests, "", defaultRetryAfter, true},
+		{http.StatusTooManyRequests, "5", 5 * time.Second, true},
+		{http.StatusTooManyRequests, "-1", defaultRetryAfter, true},
+		{http.StatusTooManyRequests, "3600", maxRetryAfter, true},
+		{http.StatusTooManyRequests, time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{http.StatusServiceUnavailable, "", 0, false},
+		{http.StatusServiceUnavailable, "2", 2 * time.Second, true},
+	}
+	for _, test := range tests {
+		delay, throttled := retryAfter(testResponse(test.status, test.retryAfter))
+		if delay != test.delay || throttled != test.throttled {
+			t.Errorf("retryAfter(%d, %q) = %v, %v, expected %v, %v", test.status, test.retryAfter, delay, throttled, test.delay, test.throttled)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(10, 2)
+	for idx := 0; idx < 2; idx++ {
+		if delay := limiter.reserve(); delay != 0 {
+			t.Fatalf("expected request %d of the burst to be sent at once, got a delay of %v", idx+1, delay)
+		}
+	}
+	if delay := limiter.reserve(); delay <= 0 || delay > 100*time.Millisecond {
+		t.Errorf("expected a delay of at most 100ms after the burst, got %v", delay)
+	}
+
+	unlimited := newRateLimiter(0, 0)
+	for idx := 0; idx < 100; idx++ {
+		if delay := unlimited.reserve(); delay != 0 {
+			t.Fatalf("expected no delay without a rate, got %v", delay)
+		}
+	}
+	unlimited.pause(time.Minute)
+	if delay := unlimited.reserve(); delay <= 50*time.Second {
+		t.Errorf("expected requests to be paused for a minute, got a delay of %v", delay)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := unlimited.wait(ctx); err != context.Canceled {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestProfileLimits(t *testing.T) {
+	profile := &ServerProfile{RateLimit: 5, MaxInFlight: 2}
+	limits := profileLimits(profile)
+	if limits.limiter.rate != 5 || cap(limits.inFlight) != 2 {
+		t.Fatalf("expected a rate of 5 and 2 in-flight slots, got %v and %d", limits.limiter.rate, cap(limits.inFlight))
+	}
+	profile.RateLimit = 1
+	if again := profileLimits(profile); again != limits || limits.limiter.rate != 1 || cap(limits.inFlight) != 2 {
+		t.Errorf("expected the limits of the profile to be updated in place")
+	}
+	profile.MaxInFlight = 0
+	if limits := profileLimits(profile); limits.inFlight != nil {
+		t.Errorf("expected no in-flight limit, got %d slots", cap(limits.inFlight))
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	var calls int32
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return testResponse(http.StatusTooManyRequests, "0"), nil
+		}
+		return testResponse(http.StatusOK, ""), nil
+	})
+	transport := newRateLimitTransport(&ServerProfile{MaxInFlight: 1}, base)
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/client/api", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected the throttled request to be retried, got %v, %v after %d calls", resp, err, calls)
+	}
+
+	// the in-flight slot is held until the response body is closed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if second, err := transport.RoundTrip(req); err == nil {
+			second.Body.Close()
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatalf("expected the second request to wait for the in-flight slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	resp.Body.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the second request to be sent once the body was closed")
+	}
+}
@@ -0,0 +1,139 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"regexp"
+	"strings"
+)
+
+var nameSupportingApis = []string{
+	"configuration",
+}
+
+// mapKeyPattern matches the keys of map args in arg descriptions, such as
+// cpuSpeed in details[0].cpuSpeed=1000
+var mapKeyPattern = regexp.MustCompile(`\b(\w+)\[\d+\]\.(\w+)`)
+
+// MapArgKeys returns the keys of a map arg of an API found in the API cache,
+// from examples in the arg description such as details[0].cpuSpeed=1000, and
+// from the fields of the API response of the same name, such as tags.key
+func MapArgKeys(api *API, arg *APIArg) []string {
+	name := strings.TrimSuffix(arg.Name, "=")
+	var keys []string
+	seen := make(map[string]bool)
+	addKey := func(key string) {
+		if len(key) > 0 && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, match := range mapKeyPattern.FindAllStringSubmatch(arg.Description, -1) {
+		if strings.EqualFold(match[1], name) {
+			addKey(match[2])
+		}
+	}
+	for _, field := range api.Response {
+		if key := strings.TrimPrefix(field.Name, name+"."); key != field.Name && !strings.Contains(key, ".") {
+			addKey(key)
+		}
+	}
+	return keys
+}
+
+// FindRelatedListAPI returns the list API for the resources an arg of an API
+// refers to, for example listZones for the zoneid arg
+func FindRelatedListAPI(arg *APIArg, apiFound *API, apiMap map[string][]*API) *API {
+	if arg.Type == "map" {
+		return nil
+	}
+
+	var autocompleteAPI *API
+	argName := strings.Replace(arg.Name, "=", "", -1)
+	relatedNoun := argName
+	switch {
+	case argName == "id" || argName == "ids":
+		// Heuristic: user is trying to autocomplete for id/ids arg for a list API
+		relatedNoun = apiFound.Noun
+		if apiFound.Verb != "list" {
+			relatedNoun += "s"
+		}
+	case argName == "account":
+		// Heuristic: user is trying to autocomplete for accounts
+		relatedNoun = "accounts"
+	case argName == "ipaddressid":
+		// Heuristic: user is trying to autocomplete for ip addresses
+		relatedNoun = "publicipaddresses"
+	case argName == "storageid":
+		relatedNoun = "storagepools"
+	case argName == "associatednetworkid":
+		relatedNoun = "networks"
+	default:
+		// Heuristic: autocomplete for the arg for which a list<Arg without id/ids>s API exists
+		// For example, for zoneid arg, listZones API exists
+		base := argName
+		if strings.HasSuffix(argName, "id") {
+			base = strings.TrimSuffix(argName, "id")
+		} else if strings.HasSuffix(argName, "ids") {
+			base = strings.TrimSuffix(argName, "ids")
+		} else if argName == "name" {
+			for _, noun := range nameSupportingApis {
+				if strings.HasPrefix(apiFound.Noun, noun) {
+					base = noun
+					break
+				}
+			}
+		}
+		relatedNoun = PluralNoun(base)
+	}
+
+	Debug("Possible related noun for the arg: ", relatedNoun, " and type: ", arg.Type)
+	autocompleteAPI = FindListAPI(apiMap, relatedNoun)
+
+	if autocompleteAPI == nil {
+		if strings.Contains(strings.ToLower(relatedNoun), "storage") {
+			relatedNoun = "storagepools"
+			autocompleteAPI = FindListAPI(apiMap, relatedNoun)
+		}
+	}
+
+	if autocompleteAPI != nil {
+		Debug("Autocomplete: API found using heuristics: ", autocompleteAPI.Name)
+	}
+
+	if strings.HasSuffix(relatedNoun, "s") {
+		relatedNoun = relatedNoun[:len(relatedNoun)-1]
+	}
+
+	// Heuristic: find any list API that contains the arg name
+	if autocompleteAPI == nil {
+		Debug("Finding possible API that have: ", argName, " related APIs: ", arg.Related)
+		possibleAPIs := []*API{}
+		for _, listAPI := range apiMap["list"] {
+			if strings.Contains(listAPI.Noun, argName) {
+				Debug("Found possible API: ", listAPI.Name)
+				possibleAPIs = append(possibleAPIs, listAPI)
+			}
+		}
+		if len(possibleAPIs) == 1 {
+			autocompleteAPI = possibleAPIs[0]
+		}
+	}
+
+	return autocompleteAPI
+}
@@ -0,0 +1,40 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapArgKeys(t *testing.T) {
+	api := &API{
+		Name: "createTags",
+		Response: []*APIResponse{
+			{Name: "tags"},
+			{Name: "tags.key"},
+			{Name: "tags.value"},
+			{Name: "tags.resource.id"},
+		},
+	}
+	arg := &APIArg{Name: "tags=", Description: "Map of tags, e.g. tags[0].key=env&tags[0].value=prod or Tags[1].owner=me, not details[0].cpuSpeed"}
+	expected := []string{"key", "value", "owner"}
+	if keys := MapArgKeys(api, arg); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected map keys %q, got %q", expected, keys)
+	}
+}
@@ -37,6 +37,8 @@ func (c *Config) StartSpinner(suffix string) *spinner.Spinner {
 	if !c.HasShell {
 		return nil
 	}
+	c.spinnerLock.Lock()
+	defer c.spinnerLock.Unlock()
 	waiter := spinner.New(cursor, 200*time.Millisecond)
 	waiter.Suffix = " " + suffix
 	waiter.Start()
@@ -44,9 +46,21 @@ func (c *Config) StartSpinner(suffix string) *spinner.Spinner {
 	return waiter
 }
 
+// UpdateSpinner updates the message shown next to a running spinner
+func (c *Config) UpdateSpinner(waiter *spinner.Spinner, suffix string) {
+	if waiter == nil {
+		return
+	}
+	waiter.Lock()
+	waiter.Suffix = " " + suffix
+	waiter.Unlock()
+}
+
 // StopSpinner stops the provided spinner if it is valid
 func (c *Config) StopSpinner(waiter *spinner.Spinner) {
 	if waiter != nil {
+		c.spinnerLock.Lock()
+		defer c.spinnerLock.Unlock()
 		waiter.Stop()
 		for i, s := range c.activeSpinners {
 			if s == waiter {
@@ -59,6 +73,8 @@ func (c *Config) StopSpinner(waiter *spinner.Spinner) {
 
 // PauseActiveSpinners stops the spinners without removing them from the acive spinners list, allowing resume.
 func (c *Config) PauseActiveSpinners() int {
+	c.spinnerLock.Lock()
+	defer c.spinnerLock.Unlock()
 	count := len(c.activeSpinners)
 	for _, s := range c.activeSpinners {
 		if s != nil && s.Active() {
@@ -70,6 +86,8 @@ func (c *Config) PauseActiveSpinners() int {
 
 // ResumePausedSpinners restarts the spinners from the active spinners list if they are not already running.
 func (c *Config) ResumePausedSpinners() {
+	c.spinnerLock.Lock()
+	defer c.spinnerLock.Unlock()
 	for _, s := range c.activeSpinners {
 		if s != nil && !s.Active() {
 			s.Start()
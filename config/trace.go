@@ -0,0 +1,339 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceSummaryOnly is the trace file value that disables HAR export and only
+// keeps timings in memory for the summary table
+const TraceSummaryOnly = "-"
+
+// TraceEntry holds the per-phase timings of a single HTTP request
+type TraceEntry struct {
+	Command      string
+	JobID        string
+	Method       string
+	URL          string
+	Params       url.Values
+	Status       int
+	Started      time.Time
+	Blocked      time.Duration
+	DNS          time.Duration
+	Connect      time.Duration
+	TLS          time.Duration
+	Send         time.Duration
+	Wait         time.Duration
+	Receive      time.Duration
+	Total        time.Duration
+	ReusedConn   bool
+	ResponseSize int64
+	Error        string
+}
+
+type httpTracer struct {
+	entries []*TraceEntry
+	mu      sync.Mutex
+}
+
+type tracingTransport struct {
+	base   http.RoundTripper
+	tracer *httpTracer
+}
+
+func newTracingTransport(cfg *Config, base http.RoundTripper) http.RoundTripper {
+	if cfg.TraceFile == "" {
+		return base
+	}
+	if cfg.tracer == nil {
+		cfg.tracer = &httpTracer{}
+	}
+	return &tracingTransport{
+		base:   base,
+		tracer: cfg.tracer,
+	}
+}
+
+// phaseTimer records the times of the phases of a request, the httptrace
+// callbacks may run on the goroutines dialing connections
+type phaseTimer struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+	spans map[string]time.Duration
+	reuse bool
+}
+
+func (p *phaseTimer) start(phase string) {
+	p.mu.Lock()
+	p.times[phase] = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *phaseTimer) done(phase string) {
+	p.mu.Lock()
+	if started, ok := p.times[phase]; ok {
+		p.spans[phase] = time.Since(started)
+	}
+	p.mu.Unlock()
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	params, err := requestParams(req)
+	if err != nil {
+		return nil, err
+	}
+	entry := &TraceEntry{
+		Command: params.Get("command"),
+		Method:  req.Method,
+		URL:     req.URL.Scheme + "://" + req.URL.Host + req.URL.Path,
+		Params:  scrubParams(params),
+		Started: time.Now(),
+	}
+	if entry.Command == "queryAsyncJobResult" {
+		entry.JobID = params.Get("jobid")
+	}
+
+	timer := &phaseTimer{times: make(map[string]time.Time), spans: make(map[string]time.Duration)}
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { timer.start("dns") },
+		DNSDone:           func(httptrace.DNSDoneInfo) { timer.done("dns") },
+		ConnectStart:      func(string, string) { timer.start("connect") },
+		ConnectDone:       func(string, string, error) { timer.done("connect") },
+		TLSHandshakeStart: func() { timer.start("tls") },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { timer.done("tls") },
+		GotConn: func(info httptrace.GotConnInfo) {
+			timer.start("gotconn")
+			timer.mu.Lock()
+			timer.reuse = info.Reused
+			timer.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { timer.start("wrote") },
+		GotFirstResponseByte: func() { timer.start("firstbyte") },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		entry.Status = resp.StatusCode
+		entry.ResponseSize = int64(len(body))
+	}
+	done := time.Now()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	timer.mu.Lock()
+	entry.DNS = timer.spans["dns"]
+	entry.Connect = timer.spans["connect"]
+	entry.TLS = timer.spans["tls"]
+	entry.ReusedConn = timer.reuse
+	gotConn, wroteRequest, firstByte := timer.times["gotconn"], timer.times["wrote"], timer.times["firstbyte"]
+	timer.mu.Unlock()
+
+	entry.Total = done.Sub(entry.Started)
+	if !gotConn.IsZero() {
+		entry.Blocked = gotConn.Sub(entry.Started) - entry.DNS - entry.Connect - entry.TLS
+		if entry.Blocked < 0 {
+			entry.Blocked = 0
+		}
+	}
+	if !wroteRequest.IsZero() && !gotConn.IsZero() {
+		entry.Send = wroteRequest.Sub(gotConn)
+	}
+	if !firstByte.IsZero() && !wroteRequest.IsZero() {
+		entry.Wait = firstByte.Sub(wroteRequest)
+		entry.Receive = done.Sub(firstByte)
+	}
+
+	t.tracer.mu.Lock()
+	t.tracer.entries = append(t.tracer.entries, entry)
+	t.tracer.mu.Unlock()
+	return resp, err
+}
+
+func scrubParams(params url.Values) url.Values {
+	scrubbed := make(url.Values)
+	for key, values := range params {
+		if secretKeys[strings.ToLower(key)] {
+			scrubbed[key] = []string{redacted}
+			continue
+		}
+		scrubbed[key] = values
+	}
+	return scrubbed
+}
+
+// TraceEntries returns the timings of the requests traced in this session
+func (c *Config) TraceEntries() []TraceEntry {
+	if c.tracer == nil {
+		return nil
+	}
+	c.tracer.mu.Lock()
+	defer c.tracer.mu.Unlock()
+	entries := make([]TraceEntry, 0, len(c.tracer.entries))
+	for _, entry := range c.tracer.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// ClearTrace removes all traced requests of this session
+func (c *Config) ClearTrace() {
+	if c.tracer == nil {
+		return
+	}
+	c.tracer.mu.Lock()
+	c.tracer.entries = nil
+	c.tracer.mu.Unlock()
+}
+
+// FlushTrace writes the traced requests of this session to the trace file,
+// the HAR file is written once on exit rather than after every request
+func (c *Config) FlushTrace() error {
+	if c.tracer == nil || c.TraceFile == "" || c.TraceFile == TraceSummaryOnly {
+		return nil
+	}
+	return c.tracer.writeHAR(c.TraceFile)
+}
+
+// ExportTraceHAR writes the traced requests of this session as a HAR file
+func (c *Config) ExportTraceHAR(fileName string) error {
+	if c.tracer == nil {
+		c.tracer = &httpTracer{}
+	}
+	return c.tracer.writeHAR(fileName)
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func harNameValues(values url.Values) []harNameValue {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := []harNameValue{}
+	for _, key := range keys {
+		for _, value := range values[key] {
+			pairs = append(pairs, harNameValue{Name: key, Value: value})
+		}
+	}
+	return pairs
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (t *httpTracer) writeHAR(fileName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := []interface{}{}
+	for _, entry := range t.entries {
+		request := map[string]interface{}{
+			"method":      entry.Method,
+			"url":         entry.URL,
+			"httpVersion": "HTTP/1.1",
+			"headers":     []harNameValue{},
+			"cookies":     []harNameValue{},
+			"queryString": []harNameValue{},
+			"headersSize": -1,
+			"bodySize":    -1,
+		}
+		if entry.Method == http.MethodGet {
+			request["queryString"] = harNameValues(entry.Params)
+		} else {
+			request["postData"] = map[string]interface{}{
+				"mimeType": "application/x-www-form-urlencoded",
+				"params":   harNameValues(entry.Params),
+			}
+		}
+		ssl := -1.0
+		if entry.TLS > 0 {
+			ssl = milliseconds(entry.TLS)
+		}
+		entries = append(entries, map[string]interface{}{
+			"startedDateTime": entry.Started.Format(time.RFC3339Nano),
+			"time":            milliseconds(entry.Total),
+			"request":         request,
+			"response": map[string]interface{}{
+				"status":      entry.Status,
+				"statusText":  http.StatusText(entry.Status),
+				"httpVersion": "HTTP/1.1",
+				"headers":     []harNameValue{},
+				"cookies":     []harNameValue{},
+				"content": map[string]interface{}{
+					"size":     entry.ResponseSize,
+					"mimeType": "application/json",
+				},
+				"redirectURL": "",
+				"headersSize": -1,
+				"bodySize":    entry.ResponseSize,
+			},
+			"cache": map[string]interface{}{},
+			"timings": map[string]interface{}{
+				"blocked": milliseconds(entry.Blocked),
+				"dns":     milliseconds(entry.DNS),
+				"connect": milliseconds(entry.Connect + entry.TLS),
+				"ssl":     ssl,
+				"send":    milliseconds(entry.Send),
+				"wait":    milliseconds(entry.Wait),
+				"receive": milliseconds(entry.Receive),
+			},
+			"_command": entry.Command,
+			"_jobid":   entry.JobID,
+			"_error":   entry.Error,
+		})
+	}
+
+	har := map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]interface{}{
+				"name":    "cmk",
+				"version": version,
+			},
+			"entries": entries,
+		},
+	}
+	output, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, output, 0600)
+}
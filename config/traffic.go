@@ -0,0 +1,311 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redacted = "redacted"
+
+// params that change on every request and are ignored when matching
+var volatileParams = map[string]bool{
+	"apikey":           true,
+	"expires":          true,
+	"response":         true,
+	"sessionkey":       true,
+	"signature":        true,
+	"signatureversion": true,
+}
+
+// params and response keys whose values are never written to a recording
+var secretKeys = map[string]bool{
+	"apikey":     true,
+	"codefor2fa": true,
+	"password":   true,
+	"privatekey": true,
+	"secretkey":  true,
+	"sessionkey": true,
+	"signature":  true,
+}
+
+// trafficEntry is a single recorded request/response pair
+type trafficEntry struct {
+	Method  string      `json:"method"`
+	Command string      `json:"command"`
+	Params  string      `json:"params"`
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    string      `json:"body"`
+}
+
+// trafficTransport records the traffic of the wrapped transport to a file,
+// or serves responses from a recording without making any network calls
+type trafficTransport struct {
+	base       http.RoundTripper
+	recordFile string
+	replay     map[string][]*trafficEntry
+	mu         sync.Mutex
+}
+
+func newTrafficTransport(cfg *Config, base http.RoundTripper) (http.RoundTripper, error) {
+	if cfg.RecordFile == "" && cfg.ReplayFile == "" {
+		return base, nil
+	}
+	t := &trafficTransport{
+		base:       base,
+		recordFile: cfg.RecordFile,
+	}
+	if cfg.ReplayFile != "" {
+		replay, err := loadRecording(cfg.ReplayFile)
+		if err != nil {
+			return replayErrorTransport{err}, err
+		}
+		t.replay = replay
+	}
+	return t, nil
+}
+
+// replayErrorTransport fails every request when the recording to replay can
+// not be loaded, so that no request is sent to the server instead
+type replayErrorTransport struct {
+	err error
+}
+
+func (t replayErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// LoadReplay replays API traffic from a recording, or stops replaying when the
+// file name is empty. The replay is unchanged if the recording fails to load.
+func (c *Config) LoadReplay(fileName string) error {
+	if fileName != "" {
+		if _, err := loadRecording(fileName); err != nil {
+			return err
+		}
+	}
+	c.ReplayFile = fileName
+	c.ActiveProfile.Client.Transport = newHTTPTransport(c)
+	return nil
+}
+
+func loadRecording(fileName string) (map[string][]*trafficEntry, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %v", err)
+	}
+	defer file.Close()
+
+	replay := make(map[string][]*trafficEntry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := &trafficEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("failed to parse recording %s: %v", fileName, err)
+		}
+		key := entry.Command + "?" + entry.Params
+		replay[key] = append(replay[key], entry)
+	}
+	return replay, scanner.Err()
+}
+
+// requestParams returns the API params sent as query string or form body
+func requestParams(req *http.Request) (url.Values, error) {
+	params := req.URL.Query()
+	if req.Body == nil || req.Method == http.MethodGet {
+		return params, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return params, nil
+	}
+	for key, values := range form {
+		params[key] = append(params[key], values...)
+	}
+	return params, nil
+}
+
+// normalizeParams drops volatile params, scrubs secrets and encodes the
+// remaining params in a stable order
+func normalizeParams(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if volatileParams[strings.ToLower(key)] || key == "command" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	normalized := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := params.Get(key)
+		if secretKeys[strings.ToLower(key)] {
+			value = redacted
+		}
+		normalized = append(normalized, url.QueryEscape(strings.ToLower(key))+"="+url.QueryEscape(value))
+	}
+	return strings.Join(normalized, "&")
+}
+
+// scrubBody replaces secret values in a JSON response body
+func scrubBody(body []byte) string {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return string(body)
+	}
+	var scrub func(node interface{})
+	scrub = func(node interface{}) {
+		switch value := node.(type) {
+		case map[string]interface{}:
+			for k, v := range value {
+				if secretKeys[strings.ToLower(k)] {
+					value[k] = redacted
+					continue
+				}
+				scrub(v)
+			}
+		case []interface{}:
+			for _, v := range value {
+				scrub(v)
+			}
+		}
+	}
+	scrub(data)
+	scrubbed, err := json.Marshal(data)
+	if err != nil {
+		return string(body)
+	}
+	return string(scrubbed)
+}
+
+// scrubHeader keeps cookie names and attributes but drops their values
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	scrubbed.Del("Set-Cookie")
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		cookie.Value = redacted
+		scrubbed.Add("Set-Cookie", cookie.String())
+	}
+	return scrubbed
+}
+
+func (t *trafficTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	params, err := requestParams(req)
+	if err != nil {
+		return nil, err
+	}
+	command := params.Get("command")
+	normalized := normalizeParams(params)
+
+	if t.replay != nil {
+		return t.replayResponse(req, command, normalized)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &trafficEntry{
+		Method:  req.Method,
+		Command: command,
+		Params:  normalized,
+		Status:  resp.StatusCode,
+		Header:  scrubHeader(resp.Header),
+		Body:    scrubBody(body),
+	}
+	if err := t.record(entry); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to record API traffic:", err)
+	}
+	return resp, nil
+}
+
+func (t *trafficTransport) record(entry *trafficEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(t.recordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// replayResponse serves recorded responses in order, repeating the last one
+// once a request has been replayed more times than it was recorded
+func (t *trafficTransport) replayResponse(req *http.Request, command string, normalized string) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := command + "?" + normalized
+	entries := t.replay[key]
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no recorded response found for %s", command)
+	}
+	entry := entries[0]
+	if len(entries) > 1 {
+		t.replay[key] = entries[1:]
+	}
+	Debug("Replaying recorded response for ", key)
+	header := entry.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,129 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeParams(t *testing.T) {
+	tests := []struct {
+		params     url.Values
+		normalized string
+	}{
+		{url.Values{"command": {"listZones"}, "name": {"zone 1"}, "id": {"z1"}}, "id=z1&name=zone+1"},
+		{url.Values{"command": {"listZones"}, "apiKey": {"k"}, "signature": {"s"}, "expires": {"e"}, "response": {"json"}}, ""},
+		{url.Values{"command": {"login"}, "username": {"admin"}, "password": {"p4ss"}}, "password=redacted&username=admin"},
+		{url.Values{"Details[0].Key": {"cpuSpeed"}}, "details%5B0%5D.key=cpuSpeed"},
+	}
+	for _, test := range tests {
+		if normalized := normalizeParams(test.params); normalized != test.normalized {
+			t.Errorf("normalizeParams(%v) = %q, expected %q", test.params, normalized, test.normalized)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	recording := filepath.Join(t.TempDir(), "traffic.jsonl")
+	calls := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		body := `{"listzonesresponse":{"count":` + strconv.Itoa(calls) + `}}`
+		if req.URL.Query().Get("command") == "login" {
+			body = `{"loginresponse":{"sessionkey":"s3cret","username":"admin"}}`
+		}
+		resp := testResponse(http.StatusOK, "")
+		resp.Body = io.NopCloser(strings.NewReader(body))
+		return resp, nil
+	})
+	recorder, err := newTrafficTransport(&Config{RecordFile: recording}, base)
+	if err != nil {
+		t.Fatalf("failed to set up recording: %v", err)
+	}
+	for _, query := range []string{
+		"command=listZones&name=zone-1&apiKey=k1&signature=s1",
+		"command=listZones&name=zone-1&apiKey=k1&signature=s2",
+		"command=login&username=admin&password=p4ss",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/client/api?"+query, nil)
+		resp, err := recorder.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("recorded request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	replayer, err := newTrafficTransport(&Config{ReplayFile: recording}, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("expected no request to be sent when replaying, got %v", req.URL)
+		return nil, nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to load recording: %v", err)
+	}
+	replay := func(method string, query string) (string, error) {
+		var req *http.Request
+		if method == http.MethodPost {
+			req, _ = http.NewRequest(method, "http://localhost/client/api", strings.NewReader(query))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(method, "http://localhost/client/api?"+query, nil)
+		}
+		resp, err := replayer.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+	tests := []struct {
+		method string
+		query  string
+		body   string
+	}{
+		{http.MethodGet, "command=listZones&name=zone-1&apiKey=other&signature=other", `{"listzonesresponse":{"count":1}}`},
+		{http.MethodPost, "command=listZones&name=zone-1", `{"listzonesresponse":{"count":2}}`},
+		{http.MethodGet, "command=listZones&name=zone-1", `{"listzonesresponse":{"count":2}}`},
+		{http.MethodGet, "command=login&username=admin&password=other", `{"loginresponse":{"sessionkey":"redacted","username":"admin"}}`},
+	}
+	for _, test := range tests {
+		body, err := replay(test.method, test.query)
+		if err != nil || body != test.body {
+			t.Errorf("replay of %s %s = %q, %v, expected %q", test.method, test.query, body, err, test.body)
+		}
+	}
+	if _, err := replay(http.MethodGet, "command=listZones&name=zone-2"); err == nil {
+		t.Errorf("expected an error for a request that was not recorded")
+	}
+
+	failing, err := newTrafficTransport(&Config{ReplayFile: filepath.Join(t.TempDir(), "missing.jsonl")}, base)
+	if err == nil {
+		t.Fatalf("expected an error for a missing recording")
+	}
+	calls = 0
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/client/api?command=listZones", nil)
+	if _, err := failing.RoundTrip(req); err == nil || calls != 0 {
+		t.Errorf("expected requests to fail without being sent when the recording failed to load, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,207 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mock
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/apache/cloudstack-cloudmonkey/config"
+)
+
+// listSize is the number of resources returned by canned list responses
+const listSize = 3
+
+type responseField struct {
+	name string
+	kind string
+}
+
+type apiSpec struct {
+	name     string
+	verb     string
+	noun     string
+	async    bool
+	required []string
+	response []responseField
+}
+
+func loadAPISpecs() map[string]*apiSpec {
+	specs := make(map[string]*apiSpec)
+	data := config.GetBundledAPICache()
+	apiList, _ := data["api"].([]interface{})
+	for _, node := range apiList {
+		api, ok := node.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := api["name"].(string)
+		async, _ := api["isasync"].(bool)
+		idx := strings.IndexFunc(name, unicode.IsUpper)
+		if idx < 0 {
+			idx = len(name)
+		}
+		spec := &apiSpec{
+			name:  name,
+			verb:  name[:idx],
+			noun:  strings.ToLower(name[idx:]),
+			async: async,
+		}
+		params, _ := api["params"].([]interface{})
+		for _, paramNode := range params {
+			param, _ := paramNode.(map[string]interface{})
+			if required, _ := param["required"].(bool); required {
+				spec.required = append(spec.required, fmt.Sprintf("%v", param["name"]))
+			}
+		}
+		response, _ := api["response"].([]interface{})
+		for _, respNode := range response {
+			resp, _ := respNode.(map[string]interface{})
+			if resp == nil || resp["name"] == nil {
+				continue
+			}
+			kind, _ := resp["type"].(string)
+			spec.response = append(spec.response, responseField{name: fmt.Sprintf("%v", resp["name"]), kind: kind})
+		}
+		specs[strings.ToLower(name)] = spec
+	}
+	return specs
+}
+
+// resourceID returns a stable UUID for the n-th resource of a kind
+func resourceID(kind string, n int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s-%d", kind, n)))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// objectName returns the key CloudStack uses for a resource in a response
+func objectName(noun string) string {
+	switch {
+	case strings.HasSuffix(noun, "sses"), strings.HasSuffix(noun, "xes"):
+		return strings.TrimSuffix(noun, "es")
+	case strings.HasSuffix(noun, "ies"):
+		return strings.TrimSuffix(noun, "ies") + "y"
+	case strings.HasSuffix(noun, "s"):
+		return strings.TrimSuffix(noun, "s")
+	}
+	return noun
+}
+
+func cannedValue(kind string, field responseField, n int) interface{} {
+	switch field.kind {
+	case "boolean":
+		return true
+	case "integer", "long", "short":
+		return n + 1
+	case "date":
+		return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02T15:04:05-0700")
+	case "list", "set", "responseobject":
+		return []interface{}{}
+	case "map", "object":
+		return map[string]interface{}{}
+	}
+	switch {
+	case field.name == "id":
+		return resourceID(kind, n)
+	case strings.HasSuffix(field.name, "id"):
+		return resourceID(strings.TrimSuffix(field.name, "id"), 0)
+	case field.name == "name" || field.name == "displaytext" || field.name == "username":
+		return fmt.Sprintf("%s-%d", kind, n+1)
+	case field.name == "state":
+		return "Running"
+	}
+	return fmt.Sprintf("%s-%d", field.name, n+1)
+}
+
+func cannedResource(spec *apiSpec, kind string, n int, params url.Values) map[string]interface{} {
+	resource := make(map[string]interface{})
+	for _, field := range spec.response {
+		resource[field.name] = cannedValue(kind, field, n)
+		if value := params.Get(field.name); value != "" && spec.verb != "list" {
+			resource[field.name] = value
+		}
+	}
+	return resource
+}
+
+func matchesFilters(resource map[string]interface{}, params url.Values) bool {
+	for _, key := range []string{"id", "name", "state"} {
+		value := params.Get(key)
+		if value == "" {
+			continue
+		}
+		if actual, ok := resource[key]; ok && !strings.EqualFold(fmt.Sprintf("%v", actual), value) {
+			return false
+		}
+	}
+	if keyword := params.Get("keyword"); keyword != "" {
+		name, _ := resource["name"].(string)
+		return strings.Contains(name, keyword)
+	}
+	return true
+}
+
+// cannedHandler builds responses for an API from its response definition
+func (s *Server) cannedHandler(spec *apiSpec) HandlerFunc {
+	return func(params url.Values) (map[string]interface{}, error) {
+		switch {
+		case spec.name == "listApis":
+			return config.GetBundledAPICache(), nil
+		case spec.name == "listCapabilities":
+			return map[string]interface{}{
+				"capability": map[string]interface{}{
+					"cloudstackversion": "4.21.0.0",
+					"apilimitinterval":  1,
+					"apilimitmax":       -1,
+				},
+			}, nil
+		case config.IsFileUploadAPI(spec.name):
+			id := resourceID(spec.noun, 0)
+			return map[string]interface{}{
+				"getuploadparams": map[string]interface{}{
+					"id":        id,
+					"postURL":   s.URL + uploadPath + id,
+					"metadata":  uploadMetadata(id),
+					"signature": s.uploadSignature(id),
+					"expires":   time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				},
+			}, nil
+		}
+
+		kind := objectName(spec.noun)
+		if spec.verb != "list" {
+			return map[string]interface{}{kind: cannedResource(spec, kind, 0, params)}, nil
+		}
+
+		var items []interface{}
+		for n := 0; n < listSize; n++ {
+			resource := cannedResource(spec, kind, n, params)
+			if matchesFilters(resource, params) {
+				items = append(items, resource)
+			}
+		}
+		if len(items) == 0 {
+			return map[string]interface{}{}, nil
+		}
+		return map[string]interface{}{"count": len(items), kind: items}, nil
+	}
+}
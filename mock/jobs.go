@@ -0,0 +1,92 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mock
+
+import (
+	"net/url"
+	"strings"
+)
+
+type job struct {
+	id       string
+	command  string
+	instance string
+	polls    int
+	result   map[string]interface{}
+	err      error
+}
+
+// startJob runs the handler for an async API and returns the job reference,
+// the result is only revealed once the job has been polled AsyncPolls times
+func (s *Server) startJob(spec *apiSpec, handler HandlerFunc, params url.Values) map[string]interface{} {
+	result, err := handler(params)
+	j := &job{
+		id:       resourceID("job", len(s.jobs)),
+		command:  spec.name,
+		instance: objectName(spec.noun),
+		result:   result,
+		err:      err,
+	}
+	s.jobs[j.id] = j
+
+	response := map[string]interface{}{"jobid": j.id}
+	if params.Get("id") != "" {
+		response["id"] = params.Get("id")
+	} else if resource, ok := result[j.instance].(map[string]interface{}); ok && resource["id"] != nil {
+		response["id"] = resource["id"]
+	}
+	return response
+}
+
+func (s *Server) queryJob(jobID string) (map[string]interface{}, error) {
+	j := s.jobs[jobID]
+	if j == nil {
+		return nil, &Error{ErrorCode: 530, CSErrorCode: 9999, ErrorText: "Unable to find job by id " + jobID}
+	}
+	j.polls++
+
+	response := map[string]interface{}{
+		"jobid":           j.id,
+		"cmd":             "org.apache.cloudstack.api.command." + j.command,
+		"jobinstancetype": strings.ToUpper(j.instance[:1]) + j.instance[1:],
+		"jobprocstatus":   0,
+		"jobstatus":       0,
+		"jobresultcode":   0,
+	}
+	if j.polls <= s.AsyncPolls {
+		response["jobprocstatus"] = j.polls
+		return response, nil
+	}
+	if j.err != nil {
+		apiErr, ok := j.err.(*Error)
+		if !ok {
+			apiErr = &Error{ErrorCode: 530, CSErrorCode: 4250, ErrorText: j.err.Error()}
+		}
+		response["jobstatus"] = 2
+		response["jobresultcode"] = 530
+		response["jobresult"] = map[string]interface{}{
+			"errorcode":   apiErr.ErrorCode,
+			"cserrorcode": apiErr.CSErrorCode,
+			"errortext":   apiErr.ErrorText,
+		}
+		return response, nil
+	}
+	response["jobstatus"] = 1
+	response["jobresult"] = j.result
+	return response, nil
+}
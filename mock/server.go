@@ -0,0 +1,406 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package mock provides a fake CloudStack management server that can be used
+// for offline testing and development of cmk.
+package mock
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default credentials accepted by the mock server
+const (
+	DefaultAPIKey    = "mock-api-key"
+	DefaultSecretKey = "mock-secret-key"
+	DefaultUsername  = "admin"
+	DefaultPassword  = "password"
+	Default2FACode   = "123456"
+)
+
+// APIPath is the path on which the mock server serves API requests
+const APIPath = "/client/api"
+
+const uploadPath = "/upload/"
+
+// HandlerFunc serves a single API call and returns the response body that is
+// placed under the <api>response key of the JSON response.
+type HandlerFunc func(params url.Values) (map[string]interface{}, error)
+
+// Error is an API error returned by the mock server, handlers may return it to
+// control the HTTP status and CloudStack error code of a failed response.
+type Error struct {
+	ErrorCode   int
+	CSErrorCode int
+	ErrorText   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("(HTTP %d, error code %d) %s", e.ErrorCode, e.CSErrorCode, e.ErrorText)
+}
+
+// Upload describes a file received on the mock upload endpoint
+type Upload struct {
+	ID       string
+	FileName string
+	Size     int64
+}
+
+type session struct {
+	key      string
+	verified bool
+}
+
+// Server is a fake CloudStack management server
+type Server struct {
+	*httptest.Server
+
+	// APIKey and SecretKey are used to verify signed requests
+	APIKey    string
+	SecretKey string
+
+	// Username, Password and Domain are accepted by the login API
+	Username string
+	Password string
+	Domain   string
+
+	// Enable2FA makes login require validation of TwoFACode
+	Enable2FA bool
+	TwoFACode string
+
+	// AsyncPolls is the number of queryAsyncJobResult calls that report a
+	// job as pending before it completes
+	AsyncPolls int
+
+	mu       sync.Mutex
+	apis     map[string]*apiSpec
+	handlers map[string]HandlerFunc
+	jobs     map[string]*job
+	sessions map[string]*session
+	calls    map[string]int
+	uploads  []Upload
+}
+
+// NewServer creates and starts a mock server using the bundled API cache
+func NewServer() *Server {
+	s := &Server{
+		APIKey:     DefaultAPIKey,
+		SecretKey:  DefaultSecretKey,
+		Username:   DefaultUsername,
+		Password:   DefaultPassword,
+		Domain:     "/",
+		TwoFACode:  Default2FACode,
+		AsyncPolls: 1,
+		apis:       loadAPISpecs(),
+		handlers:   make(map[string]HandlerFunc),
+		jobs:       make(map[string]*job),
+		sessions:   make(map[string]*session),
+		calls:      make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(uploadPath, s.serveUpload)
+	mux.HandleFunc("/", s.serveAPI)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// APIURL returns the API endpoint URL of the mock server
+func (s *Server) APIURL() string {
+	return s.URL + APIPath
+}
+
+// Handle registers a custom handler for an API, overriding canned responses.
+// Handlers run while the server lock is held and must not call back into it.
+func (s *Server) Handle(api string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[strings.ToLower(api)] = handler
+}
+
+// CallCount returns the number of authenticated calls received for an API
+func (s *Server) CallCount(api string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.ToLower(api)]
+}
+
+// Uploads returns the files received on the upload endpoint
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Upload(nil), s.uploads...)
+}
+
+// ExpireSessions invalidates all login sessions, forcing clients to log in again
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]*session)
+}
+
+func randomKey(size int) string {
+	buf := make([]byte, size)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// encodeParams encodes params in the same canonical form clients sign
+func encodeParams(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key == "signature" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		if buf.Len() > 0 {
+			buf.WriteByte('&')
+		}
+		escaped := url.QueryEscape(params.Get(key))
+		escaped = strings.Replace(escaped, "+", "%20", -1)
+		escaped = strings.Replace(escaped, "%2A", "*", -1)
+		buf.WriteString(key + "=" + escaped)
+	}
+	return buf.String()
+}
+
+func (s *Server) verifySignature(params url.Values) bool {
+	if params.Get("apiKey") != s.APIKey {
+		return false
+	}
+	if expires := params.Get("expires"); expires != "" {
+		expiry, err := time.Parse(time.RFC3339, expires)
+		if err != nil || time.Now().After(expiry) {
+			return false
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(s.SecretKey))
+	mac.Write([]byte(strings.ToLower(encodeParams(params))))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(params.Get("signature")))
+}
+
+func (s *Server) findSession(r *http.Request, params url.Values) *session {
+	key := params.Get("sessionkey")
+	if key == "" {
+		if cookie, err := r.Cookie("sessionkey"); err == nil {
+			key = cookie.Value
+		}
+	}
+	return s.sessions[key]
+}
+
+func writeResponse(w http.ResponseWriter, key string, status int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{key: body})
+}
+
+func writeError(w http.ResponseWriter, command string, err error) {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		apiErr = &Error{ErrorCode: 530, CSErrorCode: 4250, ErrorText: err.Error()}
+	}
+	writeResponse(w, strings.ToLower(command)+"response", apiErr.ErrorCode, map[string]interface{}{
+		"uuidList":    []interface{}{},
+		"errorcode":   apiErr.ErrorCode,
+		"cserrorcode": apiErr.CSErrorCode,
+		"errortext":   apiErr.ErrorText,
+	})
+}
+
+var errUnauthorized = &Error{
+	ErrorCode:   401,
+	CSErrorCode: 9999,
+	ErrorText:   "unable to verify user credentials and/or request signature",
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, "", &Error{ErrorCode: 400, CSErrorCode: 9999, ErrorText: err.Error()})
+		return
+	}
+	params := r.Form
+	command := params.Get("command")
+	if command == "" {
+		writeError(w, "", &Error{ErrorCode: 400, CSErrorCode: 9999, ErrorText: "missing command parameter"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToLower(command) {
+	case "login":
+		s.login(w, params)
+		return
+	case "logout":
+		if sess := s.findSession(r, params); sess != nil {
+			delete(s.sessions, sess.key)
+		}
+		writeResponse(w, "logoutresponse", http.StatusOK, map[string]interface{}{"description": "success"})
+		return
+	}
+
+	if params.Has("signature") {
+		if !s.verifySignature(params) {
+			writeError(w, command, errUnauthorized)
+			return
+		}
+	} else {
+		sess := s.findSession(r, params)
+		if sess == nil {
+			writeError(w, command, errUnauthorized)
+			return
+		}
+		if strings.ToLower(command) == "validateusertwofactorauthenticationcode" {
+			s.validate2FA(w, sess, params)
+			return
+		}
+		if !sess.verified {
+			writeError(w, command, errUnauthorized)
+			return
+		}
+	}
+
+	s.calls[strings.ToLower(command)]++
+	response, err := s.dispatch(command, params)
+	if err != nil {
+		writeError(w, command, err)
+		return
+	}
+	writeResponse(w, strings.ToLower(command)+"response", http.StatusOK, response)
+}
+
+func (s *Server) login(w http.ResponseWriter, params url.Values) {
+	domain := params.Get("domain")
+	if domain == "" {
+		domain = "/"
+	}
+	if params.Get("username") != s.Username || params.Get("password") != s.Password || domain != s.Domain {
+		writeError(w, "login", &Error{ErrorCode: 401, CSErrorCode: 9999, ErrorText: "Failed to authenticate user " + params.Get("username") + " in domain " + domain})
+		return
+	}
+	sess := &session{key: randomKey(16), verified: !s.Enable2FA}
+	s.sessions[sess.key] = sess
+	http.SetCookie(w, &http.Cookie{
+		Name:    "sessionkey",
+		Value:   sess.key,
+		Path:    "/",
+		Expires: time.Now().Add(30 * time.Minute),
+	})
+	writeResponse(w, "loginresponse", http.StatusOK, map[string]interface{}{
+		"username":      s.Username,
+		"userid":        resourceID("user", 0),
+		"account":       s.Username,
+		"domainid":      resourceID("domain", 0),
+		"timeout":       "1800",
+		"type":          "ADMIN",
+		"sessionkey":    sess.key,
+		"is2faenabled":  fmt.Sprintf("%v", s.Enable2FA),
+		"is2faverified": fmt.Sprintf("%v", sess.verified),
+	})
+}
+
+func (s *Server) validate2FA(w http.ResponseWriter, sess *session, params url.Values) {
+	if params.Get("codefor2fa") != s.TwoFACode {
+		writeError(w, "validateUserTwoFactorAuthenticationCode", &Error{ErrorCode: 401, CSErrorCode: 9999, ErrorText: "two factor authentication code provided is invalid"})
+		return
+	}
+	sess.verified = true
+	writeResponse(w, "validateusertwofactorauthenticationcoderesponse", http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) dispatch(command string, params url.Values) (map[string]interface{}, error) {
+	name := strings.ToLower(command)
+	if name == "queryasyncjobresult" {
+		return s.queryJob(params.Get("jobid"))
+	}
+
+	spec := s.apis[name]
+	handler := s.handlers[name]
+	if spec == nil && handler == nil {
+		return nil, &Error{ErrorCode: 432, CSErrorCode: 9999, ErrorText: "The given command: " + command + " does not exist or it is not available for user"}
+	}
+	if spec != nil {
+		for _, required := range spec.required {
+			if params.Get(required) == "" {
+				return nil, &Error{ErrorCode: 431, CSErrorCode: 4350, ErrorText: "Unable to execute API command " + name + " due to missing parameter " + required}
+			}
+		}
+	}
+
+	if handler == nil {
+		handler = s.cannedHandler(spec)
+	}
+	if spec != nil && spec.async {
+		return s.startJob(spec, handler, params), nil
+	}
+	return handler(params)
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, uploadPath)
+	if r.Header.Get("x-signature") != s.uploadSignature(id) || r.Header.Get("x-metadata") != uploadMetadata(id) || r.Header.Get("x-expires") == "" {
+		http.Error(w, "invalid upload signature", http.StatusForbidden)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	size, _ := bytes.NewBuffer(nil).ReadFrom(file)
+
+	s.mu.Lock()
+	s.uploads = append(s.uploads, Upload{ID: id, FileName: header.Filename, Size: size})
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) uploadSignature(id string) string {
+	mac := hmac.New(sha1.New, []byte(s.SecretKey))
+	mac.Write([]byte(id))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func uploadMetadata(id string) string {
+	return base64.StdEncoding.EncodeToString([]byte("upload:" + id))
+}
@@ -0,0 +1,140 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// PollOptions controls how the result of an async job is polled
+type PollOptions struct {
+	// Interval is the delay before the first poll, defaults to 2 seconds
+	Interval time.Duration
+	// Backoff multiplies the interval after each poll of a pending job
+	Backoff float64
+	// MaxInterval caps the interval when backing off
+	MaxInterval time.Duration
+	// Timeout is the maximum time to wait for the job, zero waits forever
+	Timeout time.Duration
+	// OnProgress is called when polling starts, after each poll of a
+	// pending job and every second while waiting
+	OnProgress func(status JobStatus)
+}
+
+// JobStatus describes the progress of a pending async job
+type JobStatus struct {
+	JobID        string
+	InstanceType string
+	ProcStatus   int
+	Elapsed      time.Duration
+}
+
+// CallAsync makes an API request and, when the response holds a job id, waits
+// for the job to finish and returns the job result
+func (c *Client) CallAsync(ctx context.Context, api string, params url.Values, opts PollOptions) (map[string]interface{}, error) {
+	response, err := c.Call(ctx, api, params)
+	if err != nil {
+		return response, err
+	}
+	jobID, ok := response["jobid"].(string)
+	if !ok {
+		return response, nil
+	}
+	return c.PollAsyncJob(ctx, jobID, opts)
+}
+
+// PollAsyncJob polls the result of an async job until it finishes
+func (c *Client) PollAsyncJob(ctx context.Context, jobID string, opts PollOptions) (map[string]interface{}, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timeoutTimer := time.NewTimer(opts.Timeout)
+		defer timeoutTimer.Stop()
+		timeout = timeoutTimer.C
+	}
+	poll := time.NewTimer(interval)
+	elapsed := time.NewTicker(time.Second)
+	defer poll.Stop()
+	defer elapsed.Stop()
+
+	startTime := time.Now()
+	status := JobStatus{JobID: jobID}
+	progress := func() {
+		if opts.OnProgress != nil {
+			status.Elapsed = time.Since(startTime)
+			opts.OnProgress(status)
+		}
+	}
+	progress()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, &AsyncJobError{JobID: jobID, Err: ctx.Err()}
+
+		case <-timeout:
+			return nil, &AsyncJobError{JobID: jobID, Err: ErrJobTimeout}
+
+		case <-elapsed.C:
+			progress()
+
+		case <-poll.C:
+			queryResult, err := c.Call(ctx, "queryAsyncJobResult", url.Values{"jobid": {jobID}})
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, &AsyncJobError{JobID: jobID, Err: ctx.Err()}
+				}
+				return queryResult, err
+			}
+
+			switch toInt(queryResult["jobstatus"]) {
+			case 0:
+				status.InstanceType, _ = queryResult["jobinstancetype"].(string)
+				status.ProcStatus = toInt(queryResult["jobprocstatus"])
+				progress()
+				if opts.Backoff > 1 {
+					interval = time.Duration(float64(interval) * opts.Backoff)
+					if opts.MaxInterval > 0 && interval > opts.MaxInterval {
+						interval = opts.MaxInterval
+					}
+				}
+
+			case 1:
+				jobResult, _ := queryResult["jobresult"].(map[string]interface{})
+				return jobResult, nil
+
+			case 2:
+				jobErr := &AsyncJobError{JobID: jobID, Result: queryResult}
+				if jobResult, ok := queryResult["jobresult"].(map[string]interface{}); ok {
+					command, _ := queryResult["cmd"].(string)
+					if apiErr := newAPIError(command, toInt(jobResult["errorcode"]), jobResult); apiErr != nil {
+						apiErr.JobID = jobID
+						jobErr.Err = apiErr
+					}
+				}
+				return queryResult, jobErr
+			}
+			poll.Reset(interval)
+		}
+	}
+}
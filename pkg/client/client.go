@@ -0,0 +1,320 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package client implements a context-aware Go client for the Apache
+// CloudStack API, supporting signed and session based requests, async job
+// polling and pagination of list APIs.
+//
+//	c := client.New(client.Config{
+//		URL:       "http://localhost:8080/client/api",
+//		APIKey:    apiKey,
+//		SecretKey: secretKey,
+//	})
+//	zones, err := c.Call(ctx, "listZones", url.Values{"available": {"true"}})
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes how a Client connects and authenticates to a management server
+type Config struct {
+	// URL is the API endpoint, for example http://localhost:8080/client/api
+	URL string
+
+	// APIKey and SecretKey are used to sign requests when both are set
+	APIKey    string
+	SecretKey string
+
+	// Username, Password and Domain are used to log in when API keys are not set
+	Username string
+	Password string
+	Domain   string
+
+	// PostRequest sends all requests using HTTP POST instead of GET
+	PostRequest bool
+
+	// LoginFallback retries requests rejected with HTTP 401 using a login
+	// session, when a username and password are also configured
+	LoginFallback bool
+
+	// HTTPClient is used for all requests, its cookie jar holds the session
+	HTTPClient *http.Client
+
+	// TwoFactorCode is called to obtain the 2FA code after logging in as a
+	// user with 2FA enabled, 2FA is not validated when it is nil
+	TwoFactorCode func() (string, error)
+
+	// OnLogin is called before logging in, the returned func after it
+	OnLogin func() func()
+
+	// Debug receives debug log messages when set
+	Debug func(params ...interface{})
+}
+
+// Client makes API requests to a CloudStack management server
+type Client struct {
+	cfg Config
+
+	// mu guards the login session, which is shared by concurrent requests
+	mu            sync.Mutex
+	sessionKey    string
+	sessionExpiry time.Time
+	login         *loginCall
+}
+
+// New creates a Client for the provided config, the provided http client is
+// copied when a cookie jar has to be added to it
+func New(cfg Config) *Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{}
+	} else if cfg.HTTPClient.Jar == nil {
+		httpClient := *cfg.HTTPClient
+		cfg.HTTPClient = &httpClient
+	}
+	if cfg.HTTPClient.Jar == nil {
+		cfg.HTTPClient.Jar, _ = cookiejar.New(nil)
+	}
+	return &Client{cfg: cfg}
+}
+
+// HTTPClient returns the http client used by the Client
+func (c *Client) HTTPClient() *http.Client {
+	return c.cfg.HTTPClient
+}
+
+func (c *Client) debug(params ...interface{}) {
+	if c.cfg.Debug != nil {
+		c.cfg.Debug(params...)
+	}
+}
+
+// EncodeParams encodes params sorted by key, as expected when signing requests
+func EncodeParams(params url.Values) string {
+	if params == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		value := params.Get(key)
+		if buf.Len() > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(key)
+		buf.WriteString("=")
+		escaped := url.QueryEscape(value)
+		// we need to ensure + (representing a space) is encoded as %20
+		escaped = strings.Replace(escaped, "+", "%20", -1)
+		// we need to ensure * is not escaped
+		escaped = strings.Replace(escaped, "%2A", "*", -1)
+		buf.WriteString(escaped)
+	}
+	return buf.String()
+}
+
+// Sign returns the signature of encoded params for a secret key
+func Sign(encodedParams string, secretKey string) string {
+	mac := hmac.New(sha1.New, []byte(secretKey))
+	mac.Write([]byte(strings.ToLower(encodedParams)))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Client) hasAPIKeys() bool {
+	return len(c.cfg.APIKey) > 0 && len(c.cfg.SecretKey) > 0
+}
+
+func (c *Client) hasPassword() bool {
+	return len(c.cfg.Username) > 0 && len(c.cfg.Password) > 0
+}
+
+func newRequestParams(api string, params url.Values) url.Values {
+	requestParams := make(url.Values)
+	for key, values := range params {
+		requestParams[key] = append([]string(nil), values...)
+	}
+	requestParams.Set("command", api)
+	requestParams.Set("response", "json")
+	requestParams.Set("signatureversion", "3")
+	requestParams.Set("expires", time.Now().UTC().Add(15*time.Minute).Format(time.RFC3339))
+	return requestParams
+}
+
+// send makes a signed request, or a session request when signing is not
+// possible or useSession is set
+func (c *Client) send(ctx context.Context, params url.Values, useSession bool) (*http.Response, error) {
+	if c.hasAPIKeys() && !useSession {
+		params.Set("apiKey", c.cfg.APIKey)
+		signature := Sign(EncodeParams(params), c.cfg.SecretKey)
+		params.Set("signature", signature)
+		return c.execute(ctx, params)
+	}
+	if !c.hasPassword() {
+		return nil, ErrNoCredentials
+	}
+	sessionKey, err := c.Login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params.Del("apiKey")
+	params.Del("signature")
+	params.Set("sessionkey", sessionKey)
+	resp, err := c.execute(ctx, params)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		// the session was ended by the server, the next request logs in again
+		c.endSession(sessionKey)
+	}
+	return resp, err
+}
+
+// execute sends params using HTTP POST when required, or GET otherwise
+func (c *Client) execute(ctx context.Context, params url.Values) (*http.Response, error) {
+	var req *http.Request
+	var err error
+	if params.Has("password") || params.Has("userdata") || c.cfg.PostRequest {
+		c.debug("Using HTTP POST for the request: ", c.cfg.URL)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, strings.NewReader(params.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		signature := params.Get("signature")
+		unsigned := make(url.Values)
+		for key, values := range params {
+			if key != "signature" {
+				unsigned[key] = values
+			}
+		}
+		requestURL := fmt.Sprintf("%s?%s", c.cfg.URL, EncodeParams(unsigned))
+		if signature != "" {
+			requestURL += "&signature=" + url.QueryEscape(signature)
+		}
+		c.debug("Using HTTP GET for the request: ", requestURL)
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.cfg.HTTPClient.Do(req)
+}
+
+func getResponseData(data map[string]interface{}) map[string]interface{} {
+	for k := range data {
+		if strings.HasSuffix(k, "response") {
+			if response, ok := data[k].(map[string]interface{}); ok {
+				return response
+			}
+		}
+	}
+	return nil
+}
+
+// Call makes an API request and returns the response data, for async APIs the
+// returned data holds the job id
+func (c *Client) Call(ctx context.Context, api string, params url.Values) (map[string]interface{}, error) {
+	requestParams := newRequestParams(api, params)
+	response, err := c.send(ctx, requestParams, false)
+	if err != nil {
+		return nil, err
+	}
+	c.debug("API response status code: ", response.StatusCode)
+
+	if response.StatusCode == http.StatusUnauthorized && c.cfg.LoginFallback && c.hasPassword() {
+		response.Body.Close()
+		response, err = c.send(ctx, requestParams, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.debug("API response body: ", string(body))
+
+	var data map[string]interface{}
+	_ = json.Unmarshal(body, &data)
+
+	apiResponse := getResponseData(data)
+	if apiResponse == nil {
+		return nil, errors.New("failed to decode response")
+	}
+	if apiErr := newAPIError(api, response.StatusCode, apiResponse); apiErr != nil {
+		return nil, apiErr
+	}
+	return apiResponse, nil
+}
+
+// ListAll calls a list API page by page and returns all items of the
+// response along with the key they are listed under
+func (c *Client) ListAll(ctx context.Context, api string, params url.Values, pageSize int) (string, []interface{}, error) {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+	var itemKey string
+	var items []interface{}
+	for page := 1; ; page++ {
+		pageParams := make(url.Values)
+		for key, values := range params {
+			pageParams[key] = values
+		}
+		pageParams.Set("page", fmt.Sprintf("%d", page))
+		pageParams.Set("pagesize", fmt.Sprintf("%d", pageSize))
+
+		response, err := c.Call(ctx, api, pageParams)
+		if err != nil {
+			return itemKey, items, err
+		}
+		var pageItems []interface{}
+		for key, value := range response {
+			if list, ok := value.([]interface{}); ok {
+				itemKey = key
+				pageItems = list
+				break
+			}
+		}
+		items = append(items, pageItems...)
+		// responses without a count end with a short page
+		count := toInt(response["count"])
+		if len(pageItems) < pageSize || (count > 0 && len(items) >= count) {
+			return itemKey, items, nil
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/cloudstack-cloudmonkey/mock"
+)
+
+func TestCallSignsRequests(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+
+	c := New(Config{URL: server.APIURL(), APIKey: server.APIKey, SecretKey: server.SecretKey})
+	response, err := c.Call(context.Background(), "listZones", url.Values{"name": {"zone-2"}})
+	if err != nil {
+		t.Fatalf("signed call failed: %v", err)
+	}
+	if count := toInt(response["count"]); count != 1 {
+		t.Errorf("expected 1 zone named zone-2, got %d", count)
+	}
+
+	c = New(Config{URL: server.APIURL(), APIKey: server.APIKey, SecretKey: "wrong-secret-key"})
+	_, err = c.Call(context.Background(), "listZones", nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("expected an HTTP 401 API error for a bad signature, got %v", err)
+	}
+	if calls := server.CallCount("listZones"); calls != 1 {
+		t.Errorf("expected 1 authenticated listZones call, got %d", calls)
+	}
+}
+
+func TestListAll(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+
+	for _, withCount := range []bool{true, false} {
+		server.Handle("listThings", func(params url.Values) (map[string]interface{}, error) {
+			page, _ := strconv.Atoi(params.Get("page"))
+			pageSize, _ := strconv.Atoi(params.Get("pagesize"))
+			var things []interface{}
+			for idx := (page - 1) * pageSize; idx < page*pageSize && idx < 5; idx++ {
+				things = append(things, map[string]interface{}{"id": strconv.Itoa(idx)})
+			}
+			response := map[string]interface{}{"thing": things}
+			if withCount {
+				response["count"] = 5
+			}
+			return response, nil
+		})
+
+		c := New(Config{URL: server.APIURL(), APIKey: server.APIKey, SecretKey: server.SecretKey})
+		calls := server.CallCount("listThings")
+		key, items, err := c.ListAll(context.Background(), "listThings", nil, 2)
+		if err != nil {
+			t.Fatalf("listing all things failed: %v", err)
+		}
+		if key != "thing" || len(items) != 5 {
+			t.Errorf("expected 5 things with count %v, got %d under %q", withCount, len(items), key)
+		}
+		if pages := server.CallCount("listThings") - calls; pages != 3 {
+			t.Errorf("expected 3 pages with count %v, got %d", withCount, pages)
+		}
+	}
+}
+
+func TestLoginWith2FA(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+	server.Enable2FA = true
+
+	codeRequests := 0
+	c := New(Config{
+		URL:      server.APIURL(),
+		Username: server.Username,
+		Password: server.Password,
+		TwoFactorCode: func() (string, error) {
+			codeRequests++
+			return server.TwoFACode, nil
+		},
+	})
+	if _, err := c.Call(context.Background(), "listZones", nil); err != nil {
+		t.Fatalf("call using a 2FA session failed: %v", err)
+	}
+	if _, err := c.Call(context.Background(), "listZones", nil); err != nil {
+		t.Fatalf("call reusing the session failed: %v", err)
+	}
+	if codeRequests != 1 {
+		t.Errorf("expected the 2FA code to be asked for once, got %d", codeRequests)
+	}
+
+	c = New(Config{
+		URL:           server.APIURL(),
+		Username:      server.Username,
+		Password:      server.Password,
+		TwoFactorCode: func() (string, error) { return "000000", nil },
+	})
+	_, err := c.Call(context.Background(), "listZones", nil)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Errorf("expected an auth error for a wrong 2FA code, got %v", err)
+	}
+
+	c = New(Config{URL: server.APIURL(), Username: server.Username, Password: "wrong-password"})
+	if _, err := c.Login(context.Background()); !errors.As(err, &authErr) || authErr.StatusCode != 401 {
+		t.Errorf("expected an HTTP 401 auth error for a wrong password, got %v", err)
+	}
+}
+
+func TestPollAsyncJob(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+	server.AsyncPolls = 2
+
+	c := New(Config{URL: server.APIURL(), APIKey: server.APIKey, SecretKey: server.SecretKey})
+	params := url.Values{"serviceofferingid": {"so"}, "templateid": {"tmpl"}, "zoneid": {"zone"}, "name": {"vm-1"}}
+	var progress []JobStatus
+	result, err := c.CallAsync(context.Background(), "deployVirtualMachine", params, PollOptions{
+		Interval:   10 * time.Millisecond,
+		OnProgress: func(status JobStatus) { progress = append(progress, status) },
+	})
+	if err != nil {
+		t.Fatalf("async call failed: %v", err)
+	}
+	vm, _ := result["virtualmachine"].(map[string]interface{})
+	if vm == nil || vm["name"] != "vm-1" {
+		t.Errorf("expected the job result to hold the deployed vm, got %v", result)
+	}
+	if polls := server.CallCount("queryAsyncJobResult"); polls != 3 {
+		t.Errorf("expected 3 job polls, got %d", polls)
+	}
+	if len(progress) == 0 || progress[0].JobID == "" {
+		t.Errorf("expected progress updates with the job id, got %v", progress)
+	}
+
+	server.Handle("deployVirtualMachine", func(params url.Values) (map[string]interface{}, error) {
+		return nil, &mock.Error{ErrorCode: 530, CSErrorCode: 4250, ErrorText: "insufficient capacity"}
+	})
+	_, err = c.CallAsync(context.Background(), "deployVirtualMachine", params, PollOptions{Interval: 10 * time.Millisecond})
+	var jobErr *AsyncJobError
+	var apiErr *APIError
+	if !errors.As(err, &jobErr) || !errors.As(err, &apiErr) || apiErr.ErrorText != "insufficient capacity" {
+		t.Errorf("expected a failed job error, got %v", err)
+	}
+
+	server.AsyncPolls = 1000
+	_, err = c.CallAsync(context.Background(), "deployVirtualMachine", params, PollOptions{
+		Interval: 10 * time.Millisecond,
+		Timeout:  50 * time.Millisecond,
+	})
+	if !errors.Is(err, ErrJobTimeout) {
+		t.Errorf("expected a job timeout, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrJobTimeout is returned when an async job does not finish within the
+// polling timeout
+var ErrJobTimeout = errors.New("async API job query timed out")
+
+// ErrNoCredentials is returned when neither API keys nor a username and
+// password are configured
+var ErrNoCredentials = errors.New("failed to authenticate to make API call, please provide either apikey/secretkey or username/password")
+
+// APIError is an error response returned by the management server. For the
+// result of a failed async job JobID is set and StatusCode is the error code
+// reported by the job.
+type APIError struct {
+	API         string
+	JobID       string
+	StatusCode  int
+	ErrorCode   int
+	CSErrorCode int
+	ErrorText   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("(HTTP %v, error code %v) %v", e.ErrorCode, e.CSErrorCode, e.ErrorText)
+}
+
+// AuthError is returned when logging in or validating 2FA fails, StatusCode
+// is the HTTP status of the rejected request if any
+type AuthError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// AsyncJobError is returned when an async job fails, its polling times out or
+// is interrupted by cancelling the context
+type AsyncJobError struct {
+	JobID  string
+	Result map[string]interface{}
+	Err    error
+}
+
+func (e *AsyncJobError) Error() string {
+	switch {
+	case errors.Is(e.Err, ErrJobTimeout):
+		return e.Err.Error()
+	case errors.Is(e.Err, context.Canceled), errors.Is(e.Err, context.DeadlineExceeded):
+		return "async API job polling interrupted"
+	}
+	if e.Err != nil {
+		return "async API failed for job " + e.JobID + ": " + e.Err.Error()
+	}
+	return "async API failed for job " + e.JobID
+}
+
+func (e *AsyncJobError) Unwrap() error {
+	return e.Err
+}
+
+func toInt(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		var i int
+		fmt.Sscanf(v, "%d", &i)
+		return i
+	}
+	return 0
+}
+
+// newAPIError returns an APIError if a response contains an error
+func newAPIError(api string, statusCode int, response map[string]interface{}) *APIError {
+	if _, ok := response["errorcode"]; !ok {
+		return nil
+	}
+	errorText, _ := response["errortext"].(string)
+	return &APIError{
+		API:         api,
+		StatusCode:  statusCode,
+		ErrorCode:   toInt(response["errorcode"]),
+		CSErrorCode: toInt(response["cserrorcode"]),
+		ErrorText:   errorText,
+	}
+}
@@ -0,0 +1,242 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func findSessionCookie(cookies []*http.Cookie) *http.Cookie {
+	if cookies == nil {
+		return nil
+	}
+	for _, cookie := range cookies {
+		if cookie.Name == "sessionkey" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func getLoginResponse(responseBody []byte) (map[string]interface{}, error) {
+	var responseMap map[string]interface{}
+	err := json.Unmarshal(responseBody, &responseMap)
+	if err != nil {
+		return nil, errors.New("failed to parse login response: " + err.Error())
+	}
+	loginRespRaw, ok := responseMap["loginresponse"]
+	if !ok {
+		return nil, errors.New("failed to parse login response, expected 'loginresponse' key not found")
+	}
+	loginResponse, ok := loginRespRaw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("failed to parse login response, expected 'loginresponse' to be a map")
+	}
+	return loginResponse, nil
+}
+
+func getResponseBooleanValue(response map[string]interface{}, key string) (bool, bool) {
+	v, found := response[key]
+	if !found {
+		return false, false
+	}
+	switch value := v.(type) {
+	case bool:
+		return true, value
+	case string:
+		return true, strings.ToLower(value) == "true"
+	case float64:
+		return true, value != 0
+	default:
+		return true, false
+	}
+}
+
+// defaultSessionTimeout is the session lifetime assumed when the server does
+// not set an expiry on the session cookie
+const defaultSessionTimeout = 15 * time.Minute
+
+// loginCall is a login in progress, which concurrent requests wait for
+type loginCall struct {
+	done       chan struct{}
+	sessionKey string
+	err        error
+}
+
+// ResetSession drops the login session, the next request logs in again
+func (c *Client) ResetSession() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessionKey = ""
+	c.sessionExpiry = time.Time{}
+}
+
+// endSession drops the login session if it is still the provided one
+func (c *Client) endSession(sessionKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessionKey == sessionKey {
+		c.sessionKey = ""
+		c.sessionExpiry = time.Time{}
+	}
+}
+
+func (c *Client) postForm(ctx context.Context, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.cfg.HTTPClient.Do(req)
+}
+
+func (c *Client) validate2FA(ctx context.Context, response map[string]interface{}, sessionKey string) error {
+	if c.cfg.TwoFactorCode == nil {
+		return nil
+	}
+	c.debug("Checking if 2FA is enabled and verified for the user ", response)
+	found, is2faEnabled := getResponseBooleanValue(response, "is2faenabled")
+	if !found || !is2faEnabled {
+		c.debug("2FA is not enabled for the user, skipping 2FA validation")
+		return nil
+	}
+	found, is2faVerified := getResponseBooleanValue(response, "is2faverified")
+	if !found || is2faVerified {
+		c.debug("2FA is already verified for the user, skipping 2FA validation")
+		return nil
+	}
+	code, err := c.cfg.TwoFactorCode()
+	if err != nil {
+		return &AuthError{Err: err}
+	}
+	params := make(url.Values)
+	params.Add("command", "validateUserTwoFactorAuthenticationCode")
+	params.Add("codefor2fa", code)
+	params.Add("sessionkey", sessionKey)
+
+	c.debug("Validating 2FA with POST URL:", c.cfg.URL, params)
+	resp, err := c.postForm(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to validate 2FA code: %w", err)
+	}
+	resp.Body.Close()
+	c.debug("ValidateUserTwoFactorAuthenticationCode POST response status code:", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		return &AuthError{StatusCode: resp.StatusCode, Err: errors.New("failed to validate 2FA code, please check the code. Invalidating session")}
+	}
+	return nil
+}
+
+// Login logs in using the configured username and password, and returns the
+// session key. An unexpired session is reused, and concurrent callers share a
+// single login.
+func (c *Client) Login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if c.sessionKey != "" && time.Now().Before(c.sessionExpiry) {
+		sessionKey := c.sessionKey
+		c.mu.Unlock()
+		return sessionKey, nil
+	}
+	if call := c.login; call != nil {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.sessionKey, call.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	call := &loginCall{done: make(chan struct{})}
+	c.login = call
+	c.mu.Unlock()
+
+	var expiry time.Time
+	call.sessionKey, expiry, call.err = c.newSession(ctx)
+
+	c.mu.Lock()
+	c.login = nil
+	if call.err == nil {
+		c.sessionKey = call.sessionKey
+		c.sessionExpiry = expiry
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.sessionKey, call.err
+}
+
+// newSession logs in and returns the session key and when it expires
+func (c *Client) newSession(ctx context.Context) (string, time.Time, error) {
+	params := make(url.Values)
+	params.Add("command", "login")
+	params.Add("username", c.cfg.Username)
+	params.Add("password", c.cfg.Password)
+	params.Add("domain", c.cfg.Domain)
+	params.Add("response", "json")
+
+	c.debug("Login POST URL:", c.cfg.URL, params)
+	var done func()
+	if c.cfg.OnLogin != nil {
+		done = c.cfg.OnLogin()
+	}
+	resp, err := c.postForm(ctx, params)
+	if done != nil {
+		done()
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to authenticate with the CloudStack server, please check the settings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	c.debug("Login POST response status code:", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, &AuthError{StatusCode: resp.StatusCode, Err: errors.New("failed to authenticate, please check the credentials")}
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	c.debug("Login response body:", string(body))
+	loginResponse, err := getLoginResponse(body)
+	if err != nil {
+		return "", time.Time{}, &AuthError{Err: err}
+	}
+
+	var sessionKey string
+	expiry := time.Now().Add(defaultSessionTimeout)
+	if sessionCookie := findSessionCookie(resp.Cookies()); sessionCookie != nil {
+		sessionKey = sessionCookie.Value
+		if sessionCookie.Expires.After(time.Now()) {
+			expiry = sessionCookie.Expires
+		}
+	}
+	if sessionKey == "" {
+		sessionKey, _ = loginResponse["sessionkey"].(string)
+	}
+
+	c.debug("Login sessionkey:", sessionKey)
+	if err := c.validate2FA(ctx, loginResponse, sessionKey); err != nil {
+		return "", time.Time{}, err
+	}
+	return sessionKey, expiry, nil
+}
@@ -0,0 +1,91 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apache/cloudstack-cloudmonkey/mock"
+)
+
+func TestNewDoesNotModifyHTTPClient(t *testing.T) {
+	httpClient := &http.Client{}
+	c := New(Config{URL: "http://localhost:8080/client/api", HTTPClient: httpClient})
+	if httpClient.Jar != nil {
+		t.Error("expected the provided http client to be left without a cookie jar")
+	}
+	if c.HTTPClient() == httpClient || c.HTTPClient().Jar == nil {
+		t.Error("expected a copy of the http client with a cookie jar")
+	}
+}
+
+func TestSessionIsSharedByConcurrentRequests(t *testing.T) {
+	server := mock.NewServer()
+	defer server.Close()
+
+	var logins int32
+	c := New(Config{
+		URL:      server.APIURL(),
+		Username: server.Username,
+		Password: server.Password,
+		OnLogin: func() func() {
+			atomic.AddInt32(&logins, 1)
+			return nil
+		},
+	})
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Call(context.Background(), "listZones", nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent call failed: %v", err)
+	}
+	if logins != 1 {
+		t.Errorf("expected concurrent requests to share a single login, got %d logins", logins)
+	}
+
+	// a session ended by the server is dropped, and the next request logs in again
+	server.ExpireSessions()
+	if _, err := c.Call(context.Background(), "listZones", nil); err == nil {
+		t.Error("expected the call using an ended session to fail")
+	}
+	if _, err := c.Call(context.Background(), "listZones", nil); err != nil {
+		t.Errorf("expected the call after the session ended to log in again, got %v", err)
+	}
+	if logins != 2 {
+		t.Errorf("expected a second login, got %d logins", logins)
+	}
+
+	c.ResetSession()
+	if _, err := c.Login(context.Background()); err != nil || logins != 3 {
+		t.Errorf("expected a login after resetting the session, got %v after %d logins", err, logins)
+	}
+}